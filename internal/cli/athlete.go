@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/vasilisp/velora/internal/config"
+	"github.com/vasilisp/velora/internal/db"
+	"github.com/vasilisp/velora/internal/util"
+)
+
+const athleteUsage = "Usage: velora athlete [list | add <name> | use <name>]\n"
+
+// selectedAthleteName returns the athlete chosen by the --athlete flag, the
+// VELORA_ATHLETE environment variable, or `velora athlete use`, in that
+// order, falling back to the default athlete.
+func selectedAthleteName(paths config.Paths, flag string) (string, error) {
+	if flag != "" {
+		return flag, nil
+	}
+
+	if name := os.Getenv("VELORA_ATHLETE"); name != "" {
+		return name, nil
+	}
+
+	name, err := paths.CurrentAthlete()
+	if err != nil || name != "" {
+		return name, err
+	}
+
+	return db.DefaultAthlete, nil
+}
+
+// athletePaths scopes the profile and skeleton files to the athlete.
+func athletePaths(paths config.Paths, athlete db.Athlete) (config.Paths, error) {
+	if athlete.Name == db.DefaultAthlete {
+		return paths, nil
+	}
+
+	return paths.ForAthlete(athlete.Name)
+}
+
+func selectAthlete(dbh *sql.DB, paths config.Paths, flag string) (db.Athlete, config.Paths, error) {
+	name, err := selectedAthleteName(paths, flag)
+	if err != nil {
+		return db.Athlete{}, paths, err
+	}
+
+	athlete, err := db.AthleteByName(dbh, name)
+	if err != nil {
+		return athlete, paths, err
+	}
+
+	paths, err = athletePaths(paths, athlete)
+	return athlete, paths, err
+}
+
+func athleteCommand(dbh *sql.DB, paths config.Paths, flag string, args []string) {
+	util.Assert(dbh != nil, "athleteCommand nil dbh")
+
+	if len(args) == 0 || args[0] == "list" {
+		current, err := selectedAthleteName(paths, flag)
+		if err != nil {
+			util.Fatalf("%v\n", err)
+		}
+
+		athletes, err := db.AllAthletes(dbh)
+		if err != nil {
+			util.Fatalf("%v\n", err)
+		}
+
+		for _, athlete := range athletes {
+			marker := " "
+			if athlete.Name == current {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, athlete.Name)
+		}
+		return
+	}
+
+	if len(args) != 2 {
+		util.Fatalf(athleteUsage)
+	}
+
+	switch args[0] {
+	case "add":
+		athlete, err := db.InsertAthlete(dbh, args[1])
+		if err != nil {
+			util.Fatalf("%v\n", err)
+		}
+
+		athleteDirs, err := athletePaths(paths, athlete)
+		if err != nil {
+			util.Fatalf("%v\n", err)
+		}
+
+		fmt.Printf("added athlete %s; put their preferences in %s\n", athlete.Name, athleteDirs.Prefs())
+	case "use":
+		athlete, err := db.AthleteByName(dbh, args[1])
+		if err != nil {
+			util.Fatalf("%v\n", err)
+		}
+
+		if err := paths.SetCurrentAthlete(athlete.Name); err != nil {
+			util.Fatalf("error selecting athlete: %v\n", err)
+		}
+	default:
+		util.Fatalf(athleteUsage)
+	}
+}
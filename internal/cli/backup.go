@@ -0,0 +1,297 @@
+package cli
+
+import (
+	"archive/zip"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vasilisp/velora/internal/config"
+	"github.com/vasilisp/velora/internal/db"
+	"github.com/vasilisp/velora/internal/util"
+)
+
+// names of the entries in a backup archive; the files of athletes other
+// than the default one are stored under athletes/<name>/
+const (
+	archiveDB       = "velora.sqlite"
+	archivePrefs    = "prefs.json"
+	archiveSkeleton = "skeleton.json"
+	archiveAthletes = "athletes"
+)
+
+type archiveEntry struct {
+	name string
+	path string
+}
+
+// athleteFileEntries lists the existing preference and skeleton files of all
+// athletes, regardless of which athlete paths is scoped to.
+func athleteFileEntries(paths config.Paths) ([]archiveEntry, error) {
+	entries := []archiveEntry{}
+
+	addIfExists := func(name, path string) {
+		if _, err := os.Stat(path); err == nil {
+			entries = append(entries, archiveEntry{name, path})
+		}
+	}
+
+	for _, file := range []string{archivePrefs, archiveSkeleton} {
+		addIfExists(file, filepath.Join(paths.Home, file))
+	}
+
+	dirs, err := os.ReadDir(paths.AthletesDir())
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		for _, file := range []string{archivePrefs, archiveSkeleton} {
+			addIfExists(archiveAthletes+"/"+dir.Name()+"/"+file, filepath.Join(paths.AthletesDir(), dir.Name(), file))
+		}
+	}
+
+	return entries, nil
+}
+
+// restorePath maps an archive entry holding athlete files to its location
+// under the data directory. Entries with unexpected names are rejected so
+// that an archive cannot write outside the data directory.
+func restorePath(paths config.Paths, name string) (string, bool) {
+	if name == archivePrefs || name == archiveSkeleton {
+		return filepath.Join(paths.Home, name), true
+	}
+
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 || parts[0] != archiveAthletes || (parts[2] != archivePrefs && parts[2] != archiveSkeleton) {
+		return "", false
+	}
+
+	if db.ValidateAthleteName(parts[1]) != nil {
+		return "", false
+	}
+
+	return filepath.Join(paths.AthletesDir(), parts[1], parts[2]), true
+}
+
+func addFileToArchive(archive *zip.Writer, name string, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// writeBackup snapshots the database and the preferences and skeletons of all
+// athletes into a zip archive at path.
+func writeBackup(dbh *sql.DB, paths config.Paths, path string) error {
+	tmpDir, err := os.MkdirTemp("", "velora-backup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshot := filepath.Join(tmpDir, archiveDB)
+	if err := db.BackupTo(dbh, snapshot); err != nil {
+		return err
+	}
+
+	athleteFiles, err := athleteFileEntries(paths)
+	if err != nil {
+		return fmt.Errorf("error listing athlete files: %v", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(file)
+
+	entries := append([]archiveEntry{{archiveDB, snapshot}}, athleteFiles...)
+
+	for _, entry := range entries {
+		if err := addFileToArchive(archive, entry.name, entry.path); err != nil {
+			archive.Close()
+			file.Close()
+			os.Remove(path)
+			return fmt.Errorf("error archiving %s: %v", entry.name, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+
+	return file.Close()
+}
+
+func backupFileName(prefix string) string {
+	return fmt.Sprintf("%s-%s.zip", prefix, time.Now().Format("20060102-150405"))
+}
+
+func backupCommand(dbh *sql.DB, paths config.Paths, args []string) {
+	if len(args) > 1 {
+		util.Fatalf("Usage: velora backup [path]\n")
+	}
+
+	path := backupFileName("velora-backup")
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	if err := writeBackup(dbh, paths, path); err != nil {
+		util.Fatalf("error writing backup: %v\n", err)
+	}
+
+	fmt.Printf("backup written to %s\n", path)
+}
+
+func extractFromArchive(file *zip.File, path string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+
+	return dst.Close()
+}
+
+func restoreCommand(dbh *sql.DB, paths config.Paths, args []string) {
+	if len(args) != 1 {
+		util.Fatalf("Usage: velora restore <archive>\n")
+	}
+
+	archive, err := zip.OpenReader(args[0])
+	if err != nil {
+		util.Fatalf("error opening archive: %v\n", err)
+	}
+	defer archive.Close()
+
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	if files[archiveDB] == nil {
+		util.Fatalf("archive %s contains no %s\n", args[0], archiveDB)
+	}
+
+	if !confirm(fmt.Sprintf("replace the current data with the contents of %s?", args[0])) {
+		return
+	}
+
+	safetyPath := filepath.Join(paths.Home, backupFileName("velora-pre-restore"))
+	if err := writeBackup(dbh, paths, safetyPath); err != nil {
+		util.Fatalf("error saving the current state before restoring: %v\n", err)
+	}
+	fmt.Printf("current state saved to %s\n", safetyPath)
+
+	tmpDir, err := os.MkdirTemp("", "velora-restore-")
+	if err != nil {
+		util.Fatalf("error creating temporary directory: %v\n", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshot := filepath.Join(tmpDir, archiveDB)
+	if err := extractFromArchive(files[archiveDB], snapshot); err != nil {
+		util.Fatalf("error extracting database: %v\n", err)
+	}
+
+	if err := db.RestoreFrom(dbh, paths.DB, snapshot); err != nil {
+		util.Fatalf("error restoring database: %v\n", err)
+	}
+
+	// athlete files that the archive does not contain did not exist when it
+	// was written; they are in the safety backup
+	current, err := athleteFileEntries(paths)
+	if err != nil {
+		util.Fatalf("error listing athlete files: %v\n", err)
+	}
+	for _, entry := range current {
+		if files[entry.name] != nil {
+			continue
+		}
+		if err := os.Remove(entry.path); err != nil {
+			util.Fatalf("error removing %s: %v\n", entry.name, err)
+		}
+	}
+
+	for name, file := range files {
+		path, ok := restorePath(paths, name)
+		if !ok {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			util.Fatalf("error restoring %s: %v\n", name, err)
+		}
+
+		if err := extractFromArchive(file, path); err != nil {
+			util.Fatalf("error restoring %s: %v\n", name, err)
+		}
+	}
+
+	fmt.Printf("restored from %s\n", args[0])
+}
+
+func doctorCommand(dbh *sql.DB) {
+	healthy := true
+
+	problems, err := db.IntegrityCheck(dbh)
+	if err != nil {
+		util.Fatalf("%v\n", err)
+	}
+
+	for _, problem := range problems {
+		fmt.Printf("integrity: %s\n", problem)
+		healthy = false
+	}
+
+	invalid, err := db.InvalidActivities(dbh)
+	if err != nil {
+		util.Fatalf("%v\n", err)
+	}
+
+	for _, activity := range invalid {
+		fmt.Printf("activity %d: %v\n", activity.ID, activity.Err)
+		healthy = false
+	}
+
+	if healthy {
+		fmt.Println("no problems found")
+		return
+	}
+
+	os.Exit(1)
+}
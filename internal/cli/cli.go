@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
 	"strconv"
 	"strings"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/vasilisp/lingograph/extra"
 	"github.com/vasilisp/lingograph/openai"
 	"github.com/vasilisp/lingograph/store"
+	"github.com/vasilisp/velora/internal/config"
 	"github.com/vasilisp/velora/internal/db"
 	"github.com/vasilisp/velora/internal/fitness"
 	"github.com/vasilisp/velora/internal/plan"
@@ -21,28 +23,64 @@ import (
 	"github.com/vasilisp/velora/internal/util"
 )
 
-func addActivityCallback(dbh *sql.DB, didAdd store.Var[bool]) func(activity db.ActivityUnsafe, r store.Store) (db.ActivityUnsafe, error) {
+// derivePowerMetrics reads the athlete's FTP only when the activity carries
+// power data, so that logging without a profile keeps working.
+func derivePowerMetrics(paths config.Paths, activity *db.ActivityUnsafe) error {
+	ftp := uint(0)
+	if activity.AvgPower > 0 || activity.NormPower > 0 {
+		p, err := profile.Read(paths.Prefs())
+		if err != nil {
+			return err
+		}
+		ftp = p.FTP
+	}
+
+	activity.DerivePowerMetrics(ftp)
+	return nil
+}
+
+func addActivityCallback(dbh *sql.DB, athleteID int64, paths config.Paths, didAdd store.Var[bool]) func(activity db.ActivityUnsafe, r store.Store) (db.ActivityUnsafe, error) {
 	return func(activity db.ActivityUnsafe, r store.Store) (db.ActivityUnsafe, error) {
-		activitySafe, err := activity.ToActivity()
+		if err := derivePowerMetrics(paths, &activity); err != nil {
+			return activity, err
+		}
+
+		_, err := activity.ToActivity()
 		if err != nil {
 			return activity, fmt.Errorf("malformed activity: %v\n", err)
 		}
 
-		activityJSON, err := json.MarshalIndent(activity, "", "  ")
+		if !reviewActivity(activity) {
+			return activity, nil
+		}
+
+		outcome, err := insertActivity(dbh, athleteID, activity, askOnDuplicate, db.SourceAdd)
 		if err != nil {
-			util.Fatalf("error marshalling activity to JSON: %v\n", err)
+			return activity, fmt.Errorf("error adding activity: %v", err)
 		}
-		fmt.Printf("read activity:\n\n%s\n\n", activityJSON)
-		if !confirm("does it look correct?") {
+
+		if outcome == skipped {
 			return activity, nil
 		}
 
-		db.InsertActivity(dbh, activitySafe)
 		store.Set(r, didAdd, true)
+		warnWornGear(dbh, athleteID)
 		return activity, nil
 	}
 }
 
+// reviewActivity shows an activity about to be added and asks the user to
+// confirm it.
+func reviewActivity(activity db.ActivityUnsafe) bool {
+	activityJSON, err := json.MarshalIndent(activity, "", "  ")
+	if err != nil {
+		util.Fatalf("error marshalling activity to JSON: %v\n", err)
+	}
+	fmt.Printf("read activity:\n\n%s\n\n", activityJSON)
+
+	return confirm("does it look correct?")
+}
+
 func confirm(prompt string) bool {
 	fmt.Printf("%s (y/n) ", prompt)
 
@@ -59,26 +97,28 @@ type writeOutcome struct {
 	DidWrite bool `json:"did_write"`
 }
 
-func writeSkeletonCallback(skeleton profile.Skeleton, r store.Store) (writeOutcome, error) {
-	skeletonString, err := json.MarshalIndent(skeleton, "", "  ")
-	if err != nil {
-		return writeOutcome{DidWrite: false}, err
-	}
+func writeSkeletonCallback(paths config.Paths) func(skeleton profile.Skeleton, r store.Store) (writeOutcome, error) {
+	return func(skeleton profile.Skeleton, r store.Store) (writeOutcome, error) {
+		skeletonString, err := json.MarshalIndent(skeleton, "", "  ")
+		if err != nil {
+			return writeOutcome{DidWrite: false}, err
+		}
 
-	fmt.Printf("Skeleton:\n\n%s\n\n", skeletonString)
-	if !confirm("Does it look correct?") {
-		return writeOutcome{DidWrite: false}, nil
-	}
+		fmt.Printf("Skeleton:\n\n%s\n\n", skeletonString)
+		if !confirm("Does it look correct?") {
+			return writeOutcome{DidWrite: false}, nil
+		}
 
-	err = profile.WriteSkeleton(&skeleton)
-	if err != nil {
-		return writeOutcome{DidWrite: false}, err
-	}
+		err = profile.WriteSkeleton(paths.Skeleton(), &skeleton)
+		if err != nil {
+			return writeOutcome{DidWrite: false}, err
+		}
 
-	return writeOutcome{DidWrite: true}, nil
+		return writeOutcome{DidWrite: true}, nil
+	}
 }
 
-func analyzeAddedActivity(dbh *sql.DB, client openai.Client, templates template.Parsed, didAdd store.Var[bool]) lingograph.Pipeline {
+func analyzeAddedActivity(dbh *sql.DB, athleteID int64, paths config.Paths, client openai.Client, templates template.Parsed, didAdd store.Var[bool]) lingograph.Pipeline {
 	util.Assert(dbh != nil, "analyzeAddedActivity nil dbh")
 
 	systemPromptComment, err := templates.Execute("header", nil)
@@ -93,7 +133,7 @@ func analyzeAddedActivity(dbh *sql.DB, client openai.Client, templates template.
 
 	actorComment := openai.NewActor(client, openai.GPT5, systemPromptComment, nil)
 
-	fitnessData, err := fitnessData(dbh)
+	fitnessData, err := fitnessData(dbh, athleteID, paths)
 	if err != nil {
 		util.Fatalf("error getting fitness data: %v\n", err)
 	}
@@ -112,7 +152,22 @@ func analyzeAddedActivity(dbh *sql.DB, client openai.Client, templates template.
 	)
 }
 
-func addActivity(dbh *sql.DB, args []string, analyze bool) {
+// sportsTemplateArgs describes the registered sports to prompt templates.
+func sportsTemplateArgs() map[string]any {
+	durationSports := []string{}
+	for _, info := range db.AllSportInfo() {
+		if info.Measure == db.ByDuration {
+			durationSports = append(durationSports, info.Name)
+		}
+	}
+
+	return map[string]any{
+		"sports":         db.AllSportInfo(),
+		"durationSports": durationSports,
+	}
+}
+
+func addActivity(dbh *sql.DB, athleteID int64, paths config.Paths, args []string, analyze bool) {
 	util.Assert(dbh != nil, "addActivity nil dbh")
 	util.Assert(len(args) == 1, "Usage: velora add <description>")
 
@@ -120,7 +175,7 @@ func addActivity(dbh *sql.DB, args []string, analyze bool) {
 
 	userPrompt := strings.Join(args, " ")
 
-	systemPrompt, err := templates.Execute("add", nil)
+	systemPrompt, err := templates.Execute("add", sportsTemplateArgs())
 	if err != nil {
 		util.Fatalf("error getting system prompt: %v\n", err)
 	}
@@ -129,11 +184,13 @@ func addActivity(dbh *sql.DB, args []string, analyze bool) {
 
 	didAdd := store.FreshVar[bool]()
 	actor := openai.NewActor(client, openai.GPT5Mini, systemPrompt, nil)
-	openai.AddFunction(actor, "add_activity", "Add an activity to the database", addActivityCallback(dbh, didAdd))
+	openai.AddFunction(actor, "add_activity", "Add an activity to the database", addActivityCallback(dbh, athleteID, paths, didAdd))
+	openai.AddFunction(actor, "add_wellness", "Add a daily wellness entry to the database", addWellnessCallback(dbh, athleteID))
 
 	timezone, _ := time.Now().Zone()
 	pipeline := lingograph.Chain(
 		lingograph.UserPrompt(fmt.Sprintf("Today is %s\n\n. The user is in the %s timezone.", time.Now().Format("2006-01-02"), timezone), false),
+		lingograph.UserPrompt(gearPrompt(dbh, athleteID), false),
 		lingograph.UserPrompt(userPrompt, false),
 		actor.Pipeline(nil, true, 3),
 	)
@@ -141,7 +198,7 @@ func addActivity(dbh *sql.DB, args []string, analyze bool) {
 	if analyze {
 		pipeline = lingograph.Chain(
 			pipeline,
-			analyzeAddedActivity(dbh, client, templates, didAdd),
+			analyzeAddedActivity(dbh, athleteID, paths, client, templates, didAdd),
 		)
 	}
 
@@ -153,24 +210,145 @@ func addActivity(dbh *sql.DB, args []string, analyze bool) {
 	}
 }
 
-func showLastActivities(dbh *sql.DB) {
-	activities, err := db.LastActivities(dbh, 10)
+func parseID(args []string, usage string) int64 {
+	if len(args) != 1 {
+		util.Fatalf("Usage: %s\n", usage)
+	}
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || id <= 0 {
+		util.Fatalf("invalid id: %s\n", args[0])
+	}
+
+	return id
+}
+
+func editInEditor(initial []byte) ([]byte, error) {
+	file, err := os.CreateTemp("", "velora-*.json")
 	if err != nil {
-		util.Fatalf("error getting last activities: %v\n", err)
+		return nil, err
 	}
+	defer os.Remove(file.Name())
 
-	for i, activity := range activities {
-		activity.OutputTo(os.Stdout)
-		if i < len(activities)-1 {
-			fmt.Println()
-		}
+	if _, err := file.Write(initial); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if strings.TrimSpace(editor) == "" {
+		editor = "vi"
+	}
+
+	// EDITOR may carry arguments, e.g. "code --wait"
+	editorArgs := strings.Fields(editor)
+	cmd := exec.Command(editorArgs[0], append(editorArgs[1:], file.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor %s failed: %v", editor, err)
+	}
+
+	return os.ReadFile(file.Name())
+}
+
+func showActivity(dbh *sql.DB, athleteID int64, args []string) {
+	util.Assert(dbh != nil, "showActivity nil dbh")
+
+	id := parseID(args, "velora show <id>")
+
+	activity, err := db.ActivityByID(dbh, athleteID, id)
+	if err != nil {
+		util.Fatalf("%v\n", err)
+	}
+
+	activity.OutputTo(os.Stdout)
+
+	if err := outputTrackTo(dbh, athleteID, id); err != nil {
+		util.Fatalf("%v\n", err)
+	}
+}
+
+func editActivity(dbh *sql.DB, athleteID int64, paths config.Paths, args []string) {
+	util.Assert(dbh != nil, "editActivity nil dbh")
+
+	id := parseID(args, "velora edit <id>")
+
+	activity, err := db.ActivityByID(dbh, athleteID, id)
+	if err != nil {
+		util.Fatalf("%v\n", err)
+	}
+
+	activityJSON, err := json.MarshalIndent(activity, "", "  ")
+	if err != nil {
+		util.Fatalf("error marshalling activity to JSON: %v\n", err)
+	}
+
+	editedJSON, err := editInEditor(activityJSON)
+	if err != nil {
+		util.Fatalf("error editing activity: %v\n", err)
+	}
+
+	var edited db.ActivityUnsafe
+	if err := json.Unmarshal(editedJSON, &edited); err != nil {
+		util.Fatalf("error parsing edited activity: %v\n", err)
+	}
+	edited.ID = id
+	if err := derivePowerMetrics(paths, &edited); err != nil {
+		util.Fatalf("%v\n", err)
+	}
+
+	activitySafe, err := edited.ToActivity()
+	if err != nil {
+		util.Fatalf("malformed activity: %v\n", err)
+	}
+
+	fmt.Printf("updated activity:\n\n")
+	edited.OutputTo(os.Stdout)
+	fmt.Println()
+	if !confirm("save changes?") {
+		return
+	}
+
+	if err := db.UpdateActivity(dbh, athleteID, id, activitySafe, db.SourceEdit); err != nil {
+		util.Fatalf("error updating activity: %v\n", err)
 	}
 }
 
-func fitnessData(dbh *sql.DB) (string, error) {
+func deleteActivity(dbh *sql.DB, athleteID int64, args []string) {
+	util.Assert(dbh != nil, "deleteActivity nil dbh")
+
+	id := parseID(args, "velora delete <id>")
+
+	activity, err := db.ActivityByID(dbh, athleteID, id)
+	if err != nil {
+		util.Fatalf("%v\n", err)
+	}
+
+	activity.OutputTo(os.Stdout)
+	fmt.Println()
+	if !confirm("move this activity to the trash?") {
+		return
+	}
+
+	if err := db.DeleteActivity(dbh, athleteID, id, db.SourceDelete); err != nil {
+		util.Fatalf("error deleting activity: %v\n", err)
+	}
+
+	fmt.Printf("moved activity %d to the trash; restore it with velora trash restore %d\n", id, id)
+}
+
+func fitnessData(dbh *sql.DB, athleteID int64, paths config.Paths) (string, error) {
 	util.Assert(dbh != nil, "fitnessData nil dbh")
 
-	fitnessData := fitness.Read(dbh)
+	fitnessData, err := fitness.Read(dbh, athleteID, paths)
+	if err != nil {
+		return "", err
+	}
 
 	fitnessBytes, err := json.MarshalIndent(fitnessData, "", "  ")
 	if err != nil {
@@ -180,7 +358,7 @@ func fitnessData(dbh *sql.DB) (string, error) {
 	return string(fitnessBytes), nil
 }
 
-func askAI(dbh *sql.DB, userPrompt string, interactive bool) {
+func askAI(dbh *sql.DB, athleteID int64, paths config.Paths, userPrompt string, interactive bool) {
 	util.Assert(dbh != nil, "askAI nil dbh")
 	util.Assert(userPrompt != "" || interactive, "askAI empty userPrompt and interactive is false")
 
@@ -196,7 +374,7 @@ func askAI(dbh *sql.DB, userPrompt string, interactive bool) {
 		util.Fatalf("error getting system prompt: %v\n", err)
 	}
 
-	fitnessData, err := fitnessData(dbh)
+	fitnessData, err := fitnessData(dbh, athleteID, paths)
 	if err != nil {
 		util.Fatalf("error getting fitness data: %v\n", err)
 	}
@@ -204,7 +382,7 @@ func askAI(dbh *sql.DB, userPrompt string, interactive bool) {
 	client := openai.NewClient(openai.APIKeyFromEnv())
 
 	actor := openai.NewActor(client, openai.GPT5, systemPrompt, nil)
-	openai.AddFunction(actor, "write_skeleton", "Write a skeleton to the database", writeSkeletonCallback)
+	openai.AddFunction(actor, "write_skeleton", "Write a skeleton to the database", writeSkeletonCallback(paths))
 
 	pipeline := lingograph.Chain(
 		lingograph.UserPrompt(fitnessData, false),
@@ -230,8 +408,12 @@ func askAI(dbh *sql.DB, userPrompt string, interactive bool) {
 	}
 }
 
-func planWorkouts(dbh *sql.DB, singleStep bool, interactive bool, numDays int) {
-	fitness := fitness.Read(dbh)
+func planWorkouts(dbh *sql.DB, athleteID int64, paths config.Paths, singleStep bool, interactive bool, numDays int) {
+	fitness, err := fitness.Read(dbh, athleteID, paths)
+	if err != nil {
+		util.Fatalf("error getting fitness data: %v\n", err)
+	}
+
 	planner := plan.NewPlanner(openai.APIKeyFromEnv(), fitness)
 
 	if singleStep {
@@ -241,31 +423,112 @@ func planWorkouts(dbh *sql.DB, singleStep bool, interactive bool, numDays int) {
 	}
 }
 
+type globalFlags struct {
+	home    string
+	db      string
+	athlete string
+}
+
+// parseGlobalFlags consumes the flags preceding the command and returns them
+// along with the remaining arguments.
+func parseGlobalFlags(args []string) (globalFlags, []string) {
+	flags := globalFlags{}
+
+	for len(args) > 0 {
+		switch args[0] {
+		case "--home":
+			flags.home = flagValue(args, 0)
+		case "--db":
+			flags.db = flagValue(args, 0)
+		case "--athlete":
+			flags.athlete = flagValue(args, 0)
+		default:
+			return flags, args
+		}
+		args = args[2:]
+	}
+
+	return flags, args
+}
+
 func Main() {
-	dbh, err := db.Init()
+	flags, args := parseGlobalFlags(os.Args[1:])
+
+	paths, err := config.Resolve(flags.home, flags.db)
+	if err != nil {
+		util.Fatalf("Error locating data: %v\n", err)
+	}
+
+	dbh, err := db.Init(paths.DB)
 	if err != nil {
 		util.Fatalf("Error initializing database: %v\n", err)
 	}
 	defer dbh.Close()
 
-	if len(os.Args) <= 1 {
-		showLastActivities(dbh)
+	if err := db.ConfigureSports(dbh, paths.Sports()); err != nil {
+		util.Fatalf("Error configuring sports: %v\n", err)
+	}
+
+	// athlete management must work even if the selected athlete does not exist
+	if len(args) > 0 && args[0] == "athlete" {
+		athleteCommand(dbh, paths, flags.athlete, args[1:])
+		return
+	}
+
+	athlete, paths, err := selectAthlete(dbh, paths, flags.athlete)
+	if err != nil {
+		util.Fatalf("Error selecting athlete: %v\n", err)
+	}
+	athleteID := athlete.ID
+
+	if len(args) == 0 {
+		showActivities(dbh, db.ActivityFilter{AthleteID: athleteID, Limit: defaultListLimit})
 		return
 	}
 
-	switch os.Args[1] {
+	command, args := args[0], args[1:]
+
+	switch command {
 	case "add":
 		analyze := false
-		args := os.Args[2:]
 		if len(args) > 0 && args[0] == "--analyze" {
 			analyze = true
 			args = args[1:]
 		}
-		addActivity(dbh, args, analyze)
+		addActivity(dbh, athleteID, paths, args, analyze)
 	case "recent":
-		showLastActivities(dbh)
+		showActivities(dbh, db.ActivityFilter{AthleteID: athleteID, Limit: defaultListLimit})
+	case "list":
+		listActivities(dbh, athleteID, args)
+	case "backup":
+		backupCommand(dbh, paths, args)
+	case "restore":
+		restoreCommand(dbh, paths, args)
+	case "doctor":
+		doctorCommand(dbh)
+	case "search":
+		searchActivities(dbh, athleteID, args)
+	case "gear":
+		gearCommand(dbh, athleteID, args)
+	case "wellness":
+		wellnessCommand(dbh, athleteID, args)
+	case "fix":
+		fixActivity(dbh, athleteID, paths, args)
+	case "show":
+		showActivity(dbh, athleteID, args)
+	case "rederive":
+		rederiveCommand(dbh, athleteID, paths, args)
+	case "edit":
+		editActivity(dbh, athleteID, paths, args)
+	case "delete":
+		deleteActivity(dbh, athleteID, args)
+	case "import":
+		importCommand(dbh, athleteID, paths, args)
+	case "trash":
+		trashCommand(dbh, athleteID, args)
+	case "history":
+		showHistory(dbh, athleteID, args)
 	case "plan":
-		args := os.Args[2:]
 		singleStep := false
 		interactive := false
 		numDays := 3
@@ -296,22 +559,18 @@ func Main() {
 				util.Fatalf("unknown plan flag: %s\n", arg)
 			}
 		}
-		planWorkouts(dbh, singleStep, interactive, numDays)
+		planWorkouts(dbh, athleteID, paths, singleStep, interactive, numDays)
 	case "ask":
 		interactive := false
-		args := os.Args[2:]
-		if len(os.Args) <= 2 {
-			askAI(dbh, "", true)
+		if len(args) == 0 {
+			askAI(dbh, athleteID, paths, "", true)
 			return
 		}
-		if os.Args[2] == "--interactive" {
+		if args[0] == "--interactive" {
 			interactive = true
-			args = os.Args[3:]
-		} else {
-			interactive = false
-			args = os.Args[2:]
+			args = args[1:]
 		}
-		askAI(dbh, strings.Join(args, " "), interactive)
+		askAI(dbh, athleteID, paths, strings.Join(args, " "), interactive)
 	default:
 		util.Fatalf("unknown command\n")
 	}
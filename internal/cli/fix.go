@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/vasilisp/lingograph"
+	"github.com/vasilisp/lingograph/extra"
+	"github.com/vasilisp/lingograph/openai"
+	"github.com/vasilisp/lingograph/store"
+	"github.com/vasilisp/velora/internal/config"
+	"github.com/vasilisp/velora/internal/db"
+	"github.com/vasilisp/velora/internal/template"
+	"github.com/vasilisp/velora/internal/util"
+)
+
+// number of recent activities the fix actor can choose from
+const fixCandidateLimit = 30
+
+type activityQuery struct {
+	Sport string `json:"sport,omitempty" jsonschema_description:"Only return activities of this sport; leave empty for all sports"`
+	Date  string `json:"date,omitempty" jsonschema_description:"Only return activities on this date, in YYYY-MM-DD format; leave empty for all dates"`
+}
+
+func findActivitiesCallback(dbh *sql.DB, athleteID int64) func(query activityQuery, r store.Store) ([]db.ActivityUnsafe, error) {
+	return func(query activityQuery, r store.Store) ([]db.ActivityUnsafe, error) {
+		filter := db.ActivityFilter{AthleteID: athleteID, Limit: fixCandidateLimit}
+
+		if query.Sport != "" {
+			sport, err := db.SportFromString(query.Sport)
+			if err != nil {
+				return nil, err
+			}
+			filter.Sports = []string{sport.String()}
+		}
+
+		if query.Date != "" {
+			date, err := time.ParseInLocation("2006-01-02", query.Date, time.Local)
+			if err != nil {
+				return nil, fmt.Errorf("invalid date %q: %v", query.Date, err)
+			}
+			filter.Since = date
+			filter.Until = date.AddDate(0, 0, 1)
+		}
+
+		return db.QueryActivities(dbh, filter)
+	}
+}
+
+func activityFields(activity db.ActivityUnsafe) map[string]any {
+	activityJSON, err := json.Marshal(activity)
+	if err != nil {
+		util.Fatalf("error marshalling activity to JSON: %v\n", err)
+	}
+
+	fields := map[string]any{}
+	if err := json.Unmarshal(activityJSON, &fields); err != nil {
+		util.Fatalf("error unmarshalling activity JSON: %v\n", err)
+	}
+
+	return fields
+}
+
+// outputActivityDiffTo prints the fields that differ between two versions of
+// an activity, one per line, and reports whether there were any.
+func outputActivityDiffTo(w io.Writer, before, after db.ActivityUnsafe) bool {
+	fieldsBefore := activityFields(before)
+	fieldsAfter := activityFields(after)
+
+	keys := []string{}
+	for key := range fieldsBefore {
+		keys = append(keys, key)
+	}
+	for key := range fieldsAfter {
+		if _, found := fieldsBefore[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	changed := false
+	for _, key := range keys {
+		valueBefore, valueAfter := fieldsBefore[key], fieldsAfter[key]
+		if reflect.DeepEqual(valueBefore, valueAfter) {
+			continue
+		}
+
+		bytesBefore, _ := json.Marshal(valueBefore)
+		bytesAfter, _ := json.Marshal(valueAfter)
+		fmt.Fprintf(w, "  %s: %s -> %s\n", key, bytesBefore, bytesAfter)
+		changed = true
+	}
+
+	return changed
+}
+
+// mergeActivity fills the fields that an update leaves unset from the stored
+// activity, so that the model does not have to repeat the whole record. An
+// empty list, unlike a missing one, clears the stored list.
+func mergeActivity(existing, update db.ActivityUnsafe) db.ActivityUnsafe {
+	merged := reflect.ValueOf(&update).Elem()
+	stored := reflect.ValueOf(existing)
+	for i := 0; i < merged.NumField(); i++ {
+		if merged.Field(i).IsZero() {
+			merged.Field(i).Set(stored.Field(i))
+		}
+	}
+	return update
+}
+
+func updateActivityCallback(dbh *sql.DB, athleteID int64, paths config.Paths) func(activity db.ActivityUnsafe, r store.Store) (writeOutcome, error) {
+	return func(activity db.ActivityUnsafe, r store.Store) (writeOutcome, error) {
+		if activity.ID <= 0 {
+			return writeOutcome{DidWrite: false}, fmt.Errorf("activity id is required")
+		}
+
+		existing, err := db.ActivityByID(dbh, athleteID, activity.ID)
+		if err != nil {
+			return writeOutcome{DidWrite: false}, err
+		}
+
+		// candidates are listed without their laps, and the model may leave
+		// out other fields too
+		activity = mergeActivity(existing, activity)
+
+		if err := derivePowerMetrics(paths, &activity); err != nil {
+			return writeOutcome{DidWrite: false}, err
+		}
+
+		activitySafe, err := activity.ToActivity()
+		if err != nil {
+			return writeOutcome{DidWrite: false}, fmt.Errorf("malformed activity: %v", err)
+		}
+
+		fmt.Printf("activity %d:\n\n", existing.ID)
+		existing.OutputTo(os.Stdout)
+		fmt.Printf("\nchanges:\n\n")
+		if !outputActivityDiffTo(os.Stdout, existing, activity) {
+			fmt.Printf("  (none)\n\n")
+			return writeOutcome{DidWrite: false}, nil
+		}
+		fmt.Println()
+
+		if !confirm("apply these changes?") {
+			return writeOutcome{DidWrite: false}, nil
+		}
+
+		if err := db.UpdateActivity(dbh, athleteID, activity.ID, activitySafe, db.SourceFix); err != nil {
+			return writeOutcome{DidWrite: false}, err
+		}
+
+		return writeOutcome{DidWrite: true}, nil
+	}
+}
+
+func fixActivity(dbh *sql.DB, athleteID int64, paths config.Paths, args []string) {
+	util.Assert(dbh != nil, "fixActivity nil dbh")
+	util.Assert(len(args) == 1, "Usage: velora fix <description>")
+
+	templates := template.MakeParsed([]string{"fix"})
+
+	systemPrompt, err := templates.Execute("fix", nil)
+	if err != nil {
+		util.Fatalf("error getting system prompt: %v\n", err)
+	}
+
+	client := openai.NewClient(openai.APIKeyFromEnv())
+
+	actor := openai.NewActor(client, openai.GPT5Mini, systemPrompt, nil)
+	openai.AddFunction(actor, "find_activities", "Find stored activities that may need correction", findActivitiesCallback(dbh, athleteID))
+	openai.AddFunction(actor, "update_activity", "Replace a stored activity with a corrected version", updateActivityCallback(dbh, athleteID, paths))
+
+	timezone, _ := time.Now().Zone()
+	pipeline := lingograph.Chain(
+		lingograph.UserPrompt(fmt.Sprintf("Today is %s\n\n. The user is in the %s timezone.", time.Now().Format("2006-01-02"), timezone), false),
+		lingograph.UserPrompt(args[0], false),
+		// first round looks up candidates, second round submits the update
+		actor.Pipeline(nil, false, 3),
+		actor.Pipeline(extra.Echoln(os.Stdout, ""), false, 3),
+	)
+
+	chat := lingograph.NewChat()
+
+	err = pipeline.Execute(chat)
+	if err != nil {
+		util.Fatalf("error correcting activity: %v\n", err)
+	}
+}
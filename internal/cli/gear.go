@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/vasilisp/velora/internal/db"
+	"github.com/vasilisp/velora/internal/util"
+)
+
+const gearUsage = "Usage: velora gear [list [--all] | add <name> --kind bike|shoes [--max-distance km] [--default] | retire <id>]\n"
+
+func addGear(dbh *sql.DB, athleteID int64, args []string) {
+	if len(args) == 0 {
+		util.Fatalf(gearUsage)
+	}
+
+	name := args[0]
+	kind := ""
+	maxDistance := -1
+	isDefault := false
+
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--kind":
+			kind = flagValue(args, i)
+			i++
+		case "--max-distance":
+			maxDistance = flagKilometers(args, i)
+			i++
+		case "--default":
+			isDefault = true
+		default:
+			util.Fatalf("unknown gear flag: %s\n", args[i])
+		}
+	}
+
+	gearKind, err := db.GearKindFromString(kind)
+	if err != nil {
+		util.Fatalf("%v\n", err)
+	}
+
+	if maxDistance < 0 {
+		maxDistance = 0
+		if gearKind == db.Shoes {
+			maxDistance = db.DefaultShoesMaxDistance
+		}
+	}
+
+	id, err := db.InsertGear(dbh, athleteID, name, gearKind, maxDistance, isDefault)
+	if err != nil {
+		util.Fatalf("error adding gear: %v\n", err)
+	}
+
+	fmt.Printf("added %s %q with id %d\n", gearKind, name, id)
+}
+
+func showGear(dbh *sql.DB, athleteID int64, includeRetired bool) {
+	gear, err := db.AllGear(dbh, athleteID, includeRetired)
+	if err != nil {
+		util.Fatalf("error getting gear: %v\n", err)
+	}
+
+	for i, item := range gear {
+		item.OutputTo(os.Stdout)
+		if i < len(gear)-1 {
+			fmt.Println()
+		}
+	}
+}
+
+// warnWornGear prints a warning for every active item of gear past its
+// configured maximum distance.
+func warnWornGear(dbh *sql.DB, athleteID int64) {
+	gear, err := db.AllGear(dbh, athleteID, false)
+	if err != nil {
+		util.Fatalf("error getting gear: %v\n", err)
+	}
+
+	for _, item := range gear {
+		if item.Worn() {
+			fmt.Fprintf(os.Stderr, "warning: gear %q (id %d) has covered %s, past its limit of %s; consider retiring it with `velora gear retire %d`\n",
+				item.Name, item.ID, util.FormatDistance(item.Distance), util.FormatDistance(item.MaxDistance), item.ID)
+		}
+	}
+}
+
+// gearPrompt describes the active gear to the add actor, so that it can map
+// mentions like "on my gravel bike" to gear ids.
+func gearPrompt(dbh *sql.DB, athleteID int64) string {
+	gear, err := db.AllGear(dbh, athleteID, false)
+	if err != nil {
+		util.Fatalf("error getting gear: %v\n", err)
+	}
+
+	if len(gear) == 0 {
+		return "The user has not registered any gear."
+	}
+
+	gearJSON, err := json.MarshalIndent(gear, "", "  ")
+	if err != nil {
+		util.Fatalf("error marshalling gear to JSON: %v\n", err)
+	}
+
+	return fmt.Sprintf("The user's gear:\n\n%s", gearJSON)
+}
+
+func gearCommand(dbh *sql.DB, athleteID int64, args []string) {
+	util.Assert(dbh != nil, "gearCommand nil dbh")
+
+	if len(args) == 0 {
+		showGear(dbh, athleteID, false)
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		showGear(dbh, athleteID, len(args) > 1 && args[1] == "--all")
+	case "add":
+		addGear(dbh, athleteID, args[1:])
+	case "retire":
+		id := parseID(args[1:], "velora gear retire <id>")
+		if err := db.RetireGear(dbh, athleteID, id); err != nil {
+			util.Fatalf("error retiring gear: %v\n", err)
+		}
+	default:
+		util.Fatalf(gearUsage)
+	}
+}
@@ -0,0 +1,276 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/vasilisp/velora/internal/config"
+	"github.com/vasilisp/velora/internal/db"
+	"github.com/vasilisp/velora/internal/importer"
+	"github.com/vasilisp/velora/internal/util"
+)
+
+const importUsage = "Usage: velora import [--duplicates ask|skip|replace|keep] <file>... | --csv <file> [--map strava|mapping.json] [--dry-run] | <strava-export.zip> [--map strava|mapping.json] [--dry-run]\n"
+
+// askSport asks for the sport of an activity whose file does not name one.
+func askSport(path string) string {
+	names := []string{}
+	for _, info := range db.AllSportInfo() {
+		names = append(names, info.Name)
+	}
+
+	for {
+		fmt.Printf("what sport is %s? [%s] ", path, strings.Join(names, "/"))
+
+		var answer string
+		if _, err := fmt.Scanln(&answer); err != nil {
+			util.Fatalf("error reading answer: %v\n", err)
+		}
+
+		if sport, err := db.SportFromString(answer); err == nil {
+			return sport.String()
+		}
+	}
+}
+
+// validateImported derives the power metrics of an imported activity and
+// checks that it can be stored and is plausible.
+func validateImported(paths config.Paths, activity *db.ActivityUnsafe) error {
+	if err := importer.CheckSpeed(*activity); err != nil {
+		return err
+	}
+
+	if err := derivePowerMetrics(paths, activity); err != nil {
+		return err
+	}
+
+	if _, err := activity.ToActivity(); err != nil {
+		return fmt.Errorf("malformed activity: %v", err)
+	}
+
+	return nil
+}
+
+// importFile reads an activity from a file, asks the user to confirm it as
+// `add` does, and stores it.
+func importFile(dbh *sql.DB, athleteID int64, paths config.Paths, path string, policy duplicatePolicy) (insertOutcome, error) {
+	file, err := importer.ReadFile(path)
+	if err != nil {
+		return skipped, err
+	}
+
+	if len(file.Unmapped) > 0 {
+		fmt.Printf("not imported from %s: %s\n", path, strings.Join(file.Unmapped, ", "))
+	}
+
+	if file.Sport == "" {
+		file.Sport = askSport(path)
+	}
+
+	activity, err := file.Activity()
+	if err != nil {
+		return skipped, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	if err := validateImported(paths, &activity); err != nil {
+		return skipped, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if !reviewActivity(activity) {
+		return skipped, nil
+	}
+
+	return insertActivity(dbh, athleteID, activity, policy, db.SourceImport)
+}
+
+// importCSV imports the rows of a CSV file through a column mapping. With
+// dryRun, it only shows the activities it would import and the rows that
+// fail validation.
+func importCSV(dbh *sql.DB, athleteID int64, paths config.Paths, path string, mapping importer.Mapping, policy duplicatePolicy, dryRun bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		util.Fatalf("%v\n", err)
+	}
+	defer f.Close()
+
+	rows, err := importer.ReadCSV(f, mapping)
+	if err != nil {
+		util.Fatalf("error reading %s: %v\n", path, err)
+	}
+
+	activities := []db.ActivityUnsafe{}
+	failed := 0
+	for _, row := range rows {
+		activity := row.Activity
+		if row.Err == nil {
+			row.Err = validateImported(paths, &activity)
+		}
+
+		if row.Err != nil {
+			fmt.Printf("line %d: %v\n", row.Line, row.Err)
+			failed++
+			continue
+		}
+
+		activities = append(activities, activity)
+	}
+
+	if dryRun {
+		for _, activity := range activities {
+			fmt.Println()
+			activity.OutputTo(os.Stdout)
+		}
+		fmt.Printf("\nwould import %d activities; %d rows failed\n", len(activities), failed)
+		return
+	}
+
+	if len(activities) == 0 || !confirm(fmt.Sprintf("import %d activities (%d rows failed)?", len(activities), failed)) {
+		return
+	}
+
+	outcomes := map[insertOutcome]int{}
+	for _, activity := range activities {
+		outcome, err := insertActivity(dbh, athleteID, activity, policy, db.SourceImport)
+		if err != nil {
+			util.Fatalf("error importing activity of %s: %v\n", activity.Time.Format("2006-01-02"), err)
+		}
+		outcomes[outcome]++
+	}
+
+	fmt.Printf("imported %d, replaced %d, skipped %d\n", outcomes[inserted], outcomes[replaced], outcomes[skipped])
+}
+
+// importArchive imports every activity of a Strava export, reading the
+// metrics from the device files it refers to, and reports its progress one
+// activity per line.
+func importArchive(dbh *sql.DB, athleteID int64, paths config.Paths, path string, mapping importer.Mapping, policy duplicatePolicy, dryRun bool) {
+	archive, err := importer.OpenArchive(path, mapping)
+	if err != nil {
+		util.Fatalf("%v\n", err)
+	}
+	defer archive.Close()
+
+	total := len(archive.Rows)
+	if !dryRun && (total == 0 || !confirm(fmt.Sprintf("import up to %d activities from %s?", total, path))) {
+		return
+	}
+
+	outcomes := map[insertOutcome]int{}
+	failed := 0
+	for i, row := range archive.Rows {
+		fmt.Printf("[%d/%d] line %d: ", i+1, total, row.Line)
+
+		activity, unmapped, err := archive.Activity(row)
+		if err == nil {
+			err = validateImported(paths, &activity)
+		}
+		if err != nil {
+			fmt.Printf("failed: %v\n", err)
+			failed++
+			continue
+		}
+
+		fmt.Printf("%s %s, %s", activity.Time.Format("2006-01-02"), activity.Sport, util.FormatDistance(activity.Distance))
+		if len(unmapped) > 0 {
+			fmt.Printf(" (without %s)", strings.Join(unmapped, ", "))
+		}
+
+		if dryRun {
+			fmt.Println()
+			outcomes[inserted]++
+			continue
+		}
+
+		outcome, err := insertActivity(dbh, athleteID, activity, policy, db.SourceImport)
+		if err != nil {
+			util.Fatalf("\nerror importing activity: %v\n", err)
+		}
+		outcomes[outcome]++
+		fmt.Printf(": %s\n", outcome)
+	}
+
+	if dryRun {
+		fmt.Printf("\nwould import %d activities; %d failed\n", outcomes[inserted], failed)
+		return
+	}
+
+	fmt.Printf("\nimported %d, replaced %d, skipped %d duplicates, %d failed\n", outcomes[inserted], outcomes[replaced], outcomes[skipped], failed)
+}
+
+func importCommand(dbh *sql.DB, athleteID int64, paths config.Paths, args []string) {
+	util.Assert(dbh != nil, "importCommand nil dbh")
+
+	policy, policySet := askOnDuplicate, false
+	files := []string{}
+	csvPath, mappingPath := "", "strava"
+	dryRun := false
+
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--duplicates":
+			var err error
+			if policy, err = duplicatePolicyFromString(flagValue(args, i)); err != nil {
+				util.Fatalf("%v\n", err)
+			}
+			policySet = true
+			i++
+		case args[i] == "--csv":
+			csvPath = flagValue(args, i)
+			i++
+		case args[i] == "--map":
+			mappingPath = flagValue(args, i)
+			i++
+		case args[i] == "--dry-run":
+			dryRun = true
+		case strings.HasPrefix(args[i], "--"):
+			util.Fatalf(importUsage)
+		default:
+			files = append(files, args[i])
+		}
+	}
+
+	if csvPath != "" {
+		if len(files) > 0 {
+			util.Fatalf(importUsage)
+		}
+
+		mapping, err := importer.ReadMapping(mappingPath)
+		if err != nil {
+			util.Fatalf("%v\n", err)
+		}
+
+		importCSV(dbh, athleteID, paths, csvPath, mapping, policy, dryRun)
+		warnWornGear(dbh, athleteID)
+		return
+	}
+
+	if len(files) == 1 && strings.HasSuffix(strings.ToLower(files[0]), ".zip") {
+		mapping, err := importer.ReadMapping(mappingPath)
+		if err != nil {
+			util.Fatalf("%v\n", err)
+		}
+
+		// archives are too large to settle duplicates one by one
+		if !policySet {
+			policy = skipDuplicates
+		}
+
+		importArchive(dbh, athleteID, paths, files[0], mapping, policy, dryRun)
+		warnWornGear(dbh, athleteID)
+		return
+	}
+
+	if len(files) == 0 || dryRun {
+		util.Fatalf(importUsage)
+	}
+
+	for _, path := range files {
+		if _, err := importFile(dbh, athleteID, paths, path, policy); err != nil {
+			util.Fatalf("%v\n", err)
+		}
+	}
+
+	warnWornGear(dbh, athleteID)
+}
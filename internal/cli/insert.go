@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/vasilisp/velora/internal/db"
+	"github.com/vasilisp/velora/internal/util"
+)
+
+type duplicatePolicy uint
+
+const (
+	askOnDuplicate duplicatePolicy = iota
+	skipDuplicates
+	replaceDuplicates
+	keepDuplicates
+)
+
+func duplicatePolicyFromString(s string) (duplicatePolicy, error) {
+	switch strings.ToLower(s) {
+	case "ask":
+		return askOnDuplicate, nil
+	case "skip":
+		return skipDuplicates, nil
+	case "replace":
+		return replaceDuplicates, nil
+	case "keep":
+		return keepDuplicates, nil
+	default:
+		return askOnDuplicate, fmt.Errorf("invalid duplicate policy: %s (expected ask, skip, replace, or keep)", s)
+	}
+}
+
+type insertOutcome uint
+
+const (
+	inserted insertOutcome = iota
+	replaced
+	skipped
+)
+
+func (o insertOutcome) String() string {
+	util.Assert(o <= skipped, "invalid insert outcome")
+	return []string{"inserted", "replaced", "skipped"}[o]
+}
+
+func choose(prompt string, options []string) string {
+	for {
+		fmt.Printf("%s [%s] ", prompt, strings.Join(options, "/"))
+
+		var answer string
+		_, err := fmt.Scanln(&answer)
+		if err != nil {
+			util.Fatalf("error reading answer: %v\n", err)
+		}
+
+		answer = strings.ToLower(answer)
+		for _, option := range options {
+			if answer == option || answer == option[:1] {
+				return option
+			}
+		}
+	}
+}
+
+func resolveDuplicate(duplicates []db.ActivityUnsafe, policy duplicatePolicy) duplicatePolicy {
+	if policy != askOnDuplicate {
+		return policy
+	}
+
+	fmt.Printf("this activity may already be logged:\n\n")
+	for _, duplicate := range duplicates {
+		duplicate.OutputTo(os.Stdout)
+		fmt.Println()
+	}
+
+	switch choose(fmt.Sprintf("skip it, replace activity %d, or keep both?", duplicates[0].ID), []string{"skip", "replace", "keep"}) {
+	case "skip":
+		return skipDuplicates
+	case "replace":
+		return replaceDuplicates
+	default:
+		return keepDuplicates
+	}
+}
+
+// replaceActivity overwrites a duplicate with an activity. Activities
+// without gear keep the gear of the duplicate, or get the default gear as
+// new activities do.
+func replaceActivity(dbh *sql.DB, athleteID int64, duplicate db.ActivityUnsafe, activity db.ActivityUnsafe, source db.Source) error {
+	if activity.GearID == 0 {
+		activity.GearID = duplicate.GearID
+	}
+
+	if activity.GearID == 0 {
+		sport, err := db.SportFromString(activity.Sport)
+		if err != nil {
+			return err
+		}
+		if activity.GearID, err = db.DefaultGearID(dbh, athleteID, sport); err != nil {
+			return fmt.Errorf("error looking up default gear: %v", err)
+		}
+	}
+
+	activitySafe, err := activity.ToActivity()
+	if err != nil {
+		return fmt.Errorf("malformed activity: %v", err)
+	}
+
+	return db.UpdateActivity(dbh, athleteID, duplicate.ID, activitySafe, source)
+}
+
+// insertActivity stores an activity unless it duplicates one already in the
+// database, in which case the policy decides whether to skip it, replace the
+// closest match, or keep both. Every insert path should go through here, and
+// source records where the activity came from in the audit log.
+func insertActivity(dbh *sql.DB, athleteID int64, activity db.ActivityUnsafe, policy duplicatePolicy, source db.Source) (insertOutcome, error) {
+	util.Assert(dbh != nil, "insertActivity nil dbh")
+
+	activitySafe, err := activity.ToActivity()
+	if err != nil {
+		return skipped, fmt.Errorf("malformed activity: %v", err)
+	}
+
+	duplicates, err := db.Duplicates(dbh, athleteID, activitySafe)
+	if err != nil {
+		return skipped, err
+	}
+
+	if len(duplicates) > 0 {
+		switch resolveDuplicate(duplicates, policy) {
+		case skipDuplicates:
+			return skipped, nil
+		case replaceDuplicates:
+			return replaced, replaceActivity(dbh, athleteID, duplicates[0], activity, source)
+		}
+	}
+
+	return inserted, db.InsertActivity(dbh, athleteID, activitySafe, source)
+}
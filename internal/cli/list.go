@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vasilisp/velora/internal/db"
+	"github.com/vasilisp/velora/internal/util"
+)
+
+// number of activities shown by `velora recent` and, unless overridden, by
+// `velora list` and `velora search`
+const defaultListLimit = 10
+
+const filterFlagsUsage = "[--sport sport]... [--since YYYY-MM-DD] [--until YYYY-MM-DD] [--min-distance km] [--max-distance km] [--recommended | --not-recommended] [--limit n] [--offset n]"
+
+func flagDate(args []string, i int) time.Time {
+	date, err := time.ParseInLocation("2006-01-02", flagValue(args, i), time.Local)
+	if err != nil {
+		util.Fatalf("invalid value for %s: %v\n", args[i], err)
+	}
+	return date
+}
+
+func flagKilometers(args []string, i int) int {
+	km, err := strconv.ParseFloat(flagValue(args, i), 64)
+	if err != nil || km < 0 {
+		util.Fatalf("invalid value for %s: %s\n", args[i], args[i+1])
+	}
+	return int(km * 1000)
+}
+
+func flagCount(args []string, i int) int {
+	n := flagInt(args, i)
+	if n < 0 {
+		util.Fatalf("%s must be non-negative\n", args[i])
+	}
+	return n
+}
+
+// parseFilterFlag consumes the filter flag at args[i], if it is one, and
+// returns the number of arguments consumed.
+func parseFilterFlag(args []string, i int, filter *db.ActivityFilter) int {
+	switch args[i] {
+	case "--sport":
+		sport, err := db.SportFromString(flagValue(args, i))
+		if err != nil {
+			util.Fatalf("%v\n", err)
+		}
+		filter.Sports = append(filter.Sports, sport.String())
+		return 2
+	case "--since":
+		filter.Since = flagDate(args, i)
+		return 2
+	case "--until":
+		// inclusive of the whole day
+		filter.Until = flagDate(args, i).AddDate(0, 0, 1)
+		return 2
+	case "--min-distance":
+		filter.MinDistance = flagKilometers(args, i)
+		return 2
+	case "--max-distance":
+		filter.MaxDistance = flagKilometers(args, i)
+		return 2
+	case "--recommended", "--not-recommended":
+		wasRecommended := args[i] == "--recommended"
+		filter.WasRecommended = &wasRecommended
+		return 1
+	case "--text":
+		filter.Text = flagValue(args, i)
+		return 2
+	case "--limit":
+		filter.Limit = flagCount(args, i)
+		return 2
+	case "--offset":
+		filter.Offset = flagCount(args, i)
+		return 2
+	}
+
+	return 0
+}
+
+func showActivities(dbh *sql.DB, filter db.ActivityFilter) {
+	util.Assert(dbh != nil, "showActivities nil dbh")
+
+	activities, err := db.QueryActivities(dbh, filter)
+	if err != nil {
+		util.Fatalf("error getting activities: %v\n", err)
+	}
+
+	for i, activity := range activities {
+		activity.OutputTo(os.Stdout)
+		if i < len(activities)-1 {
+			fmt.Println()
+		}
+	}
+
+	warnWornGear(dbh, filter.AthleteID)
+}
+
+func listActivities(dbh *sql.DB, athleteID int64, args []string) {
+	filter := db.ActivityFilter{AthleteID: athleteID, Limit: defaultListLimit}
+
+	for i := 0; i < len(args); {
+		n := parseFilterFlag(args, i, &filter)
+		if n == 0 {
+			util.Fatalf("Usage: velora list %s [--text query]\n", filterFlagsUsage)
+		}
+		i += n
+	}
+
+	showActivities(dbh, filter)
+}
+
+func searchActivities(dbh *sql.DB, athleteID int64, args []string) {
+	filter := db.ActivityFilter{AthleteID: athleteID, Limit: defaultListLimit}
+	terms := []string{}
+
+	for i := 0; i < len(args); {
+		if n := parseFilterFlag(args, i, &filter); n > 0 {
+			i += n
+			continue
+		}
+
+		if strings.HasPrefix(args[i], "--") {
+			util.Fatalf("unknown search flag: %s\n", args[i])
+		}
+
+		terms = append(terms, args[i])
+		i++
+	}
+
+	if len(terms) == 0 {
+		util.Fatalf("Usage: velora search %s <query>\n", filterFlagsUsage)
+	}
+
+	filter.Text = strings.Join(terms, " ")
+	showActivities(dbh, filter)
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/vasilisp/velora/internal/config"
+	"github.com/vasilisp/velora/internal/db"
+	"github.com/vasilisp/velora/internal/track"
+	"github.com/vasilisp/velora/internal/util"
+)
+
+const rederiveUsage = "velora rederive <id> | --all"
+
+// outputTrackTo summarizes the stored track of an activity, if any.
+func outputTrackTo(dbh *sql.DB, athleteID int64, id int64) error {
+	data, err := db.TrackOf(dbh, athleteID, id)
+	if err != nil || data == nil {
+		return err
+	}
+
+	t, err := track.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	metrics := t.Metrics()
+	fmt.Printf("Track: %d points, moving %s of %s\n", len(t.Points), util.FormatDuration(metrics.MovingTime), util.FormatDuration(metrics.ElapsedTime))
+	return nil
+}
+
+// rederive recomputes the metrics of an activity from its stored track.
+func rederive(dbh *sql.DB, athleteID int64, paths config.Paths, id int64) (db.ActivityUnsafe, db.ActivityUnsafe, error) {
+	before, err := db.ActivityByID(dbh, athleteID, id)
+	if err != nil {
+		return before, before, err
+	}
+
+	data, err := db.TrackOf(dbh, athleteID, id)
+	if err != nil {
+		return before, before, err
+	}
+	if data == nil {
+		return before, before, fmt.Errorf("activity %d has no track", id)
+	}
+
+	t, err := track.Decode(data)
+	if err != nil {
+		return before, before, err
+	}
+
+	after := before
+	t.Metrics().Apply(&after)
+
+	if err := derivePowerMetrics(paths, &after); err != nil {
+		return before, after, err
+	}
+
+	return before, after, nil
+}
+
+func rederiveCommand(dbh *sql.DB, athleteID int64, paths config.Paths, args []string) {
+	util.Assert(dbh != nil, "rederiveCommand nil dbh")
+
+	var ids []int64
+	if len(args) == 1 && args[0] == "--all" {
+		var err error
+		if ids, err = db.ActivitiesWithTracks(dbh, athleteID); err != nil {
+			util.Fatalf("%v\n", err)
+		}
+	} else {
+		ids = []int64{parseID(args, rederiveUsage)}
+	}
+
+	// every activity is checked before asking, so that a bad track or an
+	// invalid result cannot stop the update halfway
+	changed := []db.ActivityUnsafe{}
+	failed := 0
+	for _, id := range ids {
+		before, after, err := rederive(dbh, athleteID, paths, id)
+		if err == nil {
+			_, err = after.ToActivity()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "activity %d: %v\n", id, err)
+			failed++
+			continue
+		}
+
+		fmt.Printf("activity %d:\n", id)
+		if !outputActivityDiffTo(os.Stdout, before, after) {
+			fmt.Printf("  (no changes)\n")
+			continue
+		}
+		changed = append(changed, after)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "\n%d activities could not be rederived and are left unchanged\n", failed)
+	}
+
+	if len(changed) == 0 && failed > 0 {
+		os.Exit(1)
+	}
+
+	if len(changed) == 0 || !confirm(fmt.Sprintf("\napply the changes to %d activities?", len(changed))) {
+		return
+	}
+
+	if err := db.UpdateActivities(dbh, athleteID, changed, db.SourceRederive); err != nil {
+		util.Fatalf("%v; no activities were changed\n", err)
+	}
+}
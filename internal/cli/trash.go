@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/vasilisp/velora/internal/db"
+	"github.com/vasilisp/velora/internal/util"
+)
+
+const trashUsage = "Usage: velora trash [list | restore <id> | purge <id> | purge --all]\n"
+
+func showTrash(dbh *sql.DB, athleteID int64) {
+	activities, err := db.QueryActivities(dbh, db.ActivityFilter{AthleteID: athleteID, Trashed: true})
+	if err != nil {
+		util.Fatalf("error getting trash: %v\n", err)
+	}
+
+	if len(activities) == 0 {
+		fmt.Println("the trash is empty")
+		return
+	}
+
+	for i, activity := range activities {
+		activity.OutputTo(os.Stdout)
+		if i < len(activities)-1 {
+			fmt.Println()
+		}
+	}
+}
+
+func purgeTrash(dbh *sql.DB, athleteID int64, args []string) {
+	if len(args) == 1 && args[0] == "--all" {
+		activities, err := db.QueryActivities(dbh, db.ActivityFilter{AthleteID: athleteID, Trashed: true})
+		if err != nil {
+			util.Fatalf("error getting trash: %v\n", err)
+		}
+
+		if len(activities) == 0 || !confirm(fmt.Sprintf("permanently delete %d activities?", len(activities))) {
+			return
+		}
+
+		for _, activity := range activities {
+			if err := db.PurgeActivity(dbh, athleteID, activity.ID); err != nil {
+				util.Fatalf("error purging activity %d: %v\n", activity.ID, err)
+			}
+		}
+		return
+	}
+
+	id := parseID(args, "velora trash purge <id> | --all")
+
+	if !confirm(fmt.Sprintf("permanently delete activity %d?", id)) {
+		return
+	}
+
+	if err := db.PurgeActivity(dbh, athleteID, id); err != nil {
+		util.Fatalf("error purging activity: %v\n", err)
+	}
+}
+
+func trashCommand(dbh *sql.DB, athleteID int64, args []string) {
+	util.Assert(dbh != nil, "trashCommand nil dbh")
+
+	if len(args) == 0 {
+		showTrash(dbh, athleteID)
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		showTrash(dbh, athleteID)
+	case "restore":
+		id := parseID(args[1:], "velora trash restore <id>")
+		if err := db.RestoreActivity(dbh, athleteID, id); err != nil {
+			util.Fatalf("error restoring activity: %v\n", err)
+		}
+	case "purge":
+		purgeTrash(dbh, athleteID, args[1:])
+	default:
+		util.Fatalf(trashUsage)
+	}
+}
+
+// showHistory prints the audit log of an activity, with the fields each
+// update changed.
+func showHistory(dbh *sql.DB, athleteID int64, args []string) {
+	util.Assert(dbh != nil, "showHistory nil dbh")
+
+	id := parseID(args, "velora history <id>")
+
+	records, err := db.AuditOf(dbh, athleteID, id)
+	if err != nil {
+		util.Fatalf("%v\n", err)
+	}
+
+	if len(records) == 0 {
+		util.Fatalf("no history for activity %d\n", id)
+	}
+
+	for _, record := range records {
+		record.OutputTo(os.Stdout)
+		if record.Old != nil && record.New != nil {
+			outputActivityDiffTo(os.Stdout, *record.Old, *record.New)
+		}
+	}
+}
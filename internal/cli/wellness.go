@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/vasilisp/lingograph/store"
+	"github.com/vasilisp/velora/internal/db"
+	"github.com/vasilisp/velora/internal/util"
+)
+
+// number of days of wellness entries shown by `velora wellness`
+const wellnessListDays = 14
+
+func addWellnessCallback(dbh *sql.DB, athleteID int64) func(entry db.WellnessUnsafe, r store.Store) (writeOutcome, error) {
+	return func(entry db.WellnessUnsafe, r store.Store) (writeOutcome, error) {
+		entrySafe, err := entry.ToWellness()
+		if err != nil {
+			return writeOutcome{DidWrite: false}, fmt.Errorf("malformed wellness entry: %v", err)
+		}
+
+		entryJSON, err := json.MarshalIndent(entry, "", "  ")
+		if err != nil {
+			util.Fatalf("error marshalling wellness entry to JSON: %v\n", err)
+		}
+		fmt.Printf("read wellness entry:\n\n%s\n\n", entryJSON)
+		if !confirm("does it look correct?") {
+			return writeOutcome{DidWrite: false}, nil
+		}
+
+		if err := db.UpsertWellness(dbh, athleteID, entrySafe); err != nil {
+			return writeOutcome{DidWrite: false}, err
+		}
+
+		return writeOutcome{DidWrite: true}, nil
+	}
+}
+
+func flagValue(args []string, i int) string {
+	if i+1 >= len(args) {
+		util.Fatalf("%s requires a value\n", args[i])
+	}
+	return args[i+1]
+}
+
+func flagInt(args []string, i int) int {
+	value, err := strconv.Atoi(flagValue(args, i))
+	if err != nil {
+		util.Fatalf("invalid value for %s: %v\n", args[i], err)
+	}
+	return value
+}
+
+func addWellness(dbh *sql.DB, athleteID int64, args []string) {
+	util.Assert(dbh != nil, "addWellness nil dbh")
+
+	entry := db.WellnessUnsafe{Date: time.Now().Format("2006-01-02")}
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--date":
+			entry.Date = flagValue(args, i)
+		case "--sleep":
+			var err error
+			entry.SleepHours, err = strconv.ParseFloat(flagValue(args, i), 64)
+			if err != nil {
+				util.Fatalf("invalid value for --sleep: %v\n", err)
+			}
+		case "--soreness":
+			entry.Soreness = flagInt(args, i)
+		case "--mood":
+			entry.Mood = flagInt(args, i)
+		case "--resting-hr":
+			entry.RestingHR = flagInt(args, i)
+		case "--notes":
+			entry.Notes = flagValue(args, i)
+		default:
+			util.Fatalf("unknown wellness flag: %s\n", args[i])
+		}
+		i++ // skip the value we've consumed
+	}
+
+	entrySafe, err := entry.ToWellness()
+	if err != nil {
+		util.Fatalf("malformed wellness entry: %v\n", err)
+	}
+
+	if err := db.UpsertWellness(dbh, athleteID, entrySafe); err != nil {
+		util.Fatalf("error saving wellness entry: %v\n", err)
+	}
+}
+
+func showWellness(dbh *sql.DB, athleteID int64) {
+	since := time.Now().AddDate(0, 0, -wellnessListDays)
+	entries, err := db.WellnessSince(dbh, athleteID, since)
+	if err != nil {
+		util.Fatalf("error getting wellness entries: %v\n", err)
+	}
+
+	for i, entry := range entries {
+		entry.OutputTo(os.Stdout)
+		if i < len(entries)-1 {
+			fmt.Println()
+		}
+	}
+}
+
+func wellnessCommand(dbh *sql.DB, athleteID int64, args []string) {
+	if len(args) == 0 || args[0] == "list" {
+		showWellness(dbh, athleteID)
+		return
+	}
+
+	switch args[0] {
+	case "add":
+		addWellness(dbh, athleteID, args[1:])
+	default:
+		util.Fatalf("Usage: velora wellness [list | add [--date YYYY-MM-DD] [--sleep hours] [--soreness 1-10] [--mood 1-10] [--resting-hr bpm] [--notes text]]\n")
+	}
+}
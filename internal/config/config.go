@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Paths locates the files velora reads and writes.
+type Paths struct {
+	// Home is the data directory holding, by default, the database
+	Home string
+	DB   string
+	// AthleteDir holds the selected athlete's prefs.json and skeleton.json
+	AthleteDir string
+}
+
+func (p Paths) Prefs() string {
+	return filepath.Join(p.AthleteDir, "prefs.json")
+}
+
+func (p Paths) Skeleton() string {
+	return filepath.Join(p.AthleteDir, "skeleton.json")
+}
+
+// Sports is the file defining additional sports, shared by all athletes.
+func (p Paths) Sports() string {
+	return filepath.Join(p.Home, "sports.json")
+}
+
+// AthletesDir is the directory containing a subdirectory per athlete, except
+// for the default athlete, whose files live directly in the data directory.
+func (p Paths) AthletesDir() string {
+	return filepath.Join(p.Home, "athletes")
+}
+
+// ForAthlete scopes the athlete files to the directory of the named athlete,
+// creating it if needed.
+func (p Paths) ForAthlete(name string) (Paths, error) {
+	p.AthleteDir = filepath.Join(p.AthletesDir(), name)
+	if err := os.MkdirAll(p.AthleteDir, 0755); err != nil {
+		return p, fmt.Errorf("cannot create athlete directory: %v", err)
+	}
+
+	return p, nil
+}
+
+func (p Paths) currentAthleteFile() string {
+	return filepath.Join(p.Home, "athlete")
+}
+
+// CurrentAthlete returns the athlete selected with SetCurrentAthlete, or ""
+// if there is none.
+func (p Paths) CurrentAthlete() (string, error) {
+	name, err := os.ReadFile(p.currentAthleteFile())
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot read selected athlete: %v", err)
+	}
+
+	return strings.TrimSpace(string(name)), nil
+}
+
+func (p Paths) SetCurrentAthlete(name string) error {
+	return os.WriteFile(p.currentAthleteFile(), []byte(name+"\n"), 0644)
+}
+
+// Resolve determines the data directory and database path. The home argument
+// takes precedence over $VELORA_HOME, which takes precedence over
+// $HOME/.velora; dbPath, if set, overrides the database location. The data
+// directory is created if needed.
+func Resolve(home string, dbPath string) (Paths, error) {
+	if home == "" {
+		home = os.Getenv("VELORA_HOME")
+	}
+
+	if home == "" {
+		userHome, err := os.UserHomeDir()
+		if err != nil {
+			return Paths{}, fmt.Errorf("cannot locate home directory: %v", err)
+		}
+		home = filepath.Join(userHome, ".velora")
+	}
+
+	if err := os.MkdirAll(home, 0755); err != nil {
+		return Paths{}, fmt.Errorf("cannot create data directory: %v", err)
+	}
+
+	if dbPath == "" {
+		dbPath = filepath.Join(home, "velora.sqlite")
+	}
+
+	dbDir := filepath.Dir(dbPath)
+	if info, err := os.Stat(dbDir); err != nil || !info.IsDir() {
+		return Paths{}, fmt.Errorf("database directory %s does not exist", dbDir)
+	}
+
+	return Paths{Home: home, DB: dbPath, AthleteDir: home}, nil
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	"github.com/vasilisp/velora/internal/util"
+)
+
+// DefaultAthlete owns all data recorded before athletes were introduced.
+const DefaultAthlete = "default"
+
+type Athlete struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// athlete names double as directory names, so keep them simple
+var athleteNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func ValidateAthleteName(name string) error {
+	if !athleteNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid athlete name %q: use letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
+
+func InsertAthlete(db *sql.DB, name string) (Athlete, error) {
+	util.Assert(db != nil, "InsertAthlete nil db")
+
+	if err := ValidateAthleteName(name); err != nil {
+		return Athlete{}, err
+	}
+
+	result, err := db.Exec(`INSERT INTO athletes (name) VALUES (?)`, name)
+	if err != nil {
+		return Athlete{}, fmt.Errorf("error adding athlete %s: %v", name, err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Athlete{}, err
+	}
+
+	return Athlete{ID: id, Name: name}, nil
+}
+
+func AthleteByName(db *sql.DB, name string) (Athlete, error) {
+	util.Assert(db != nil, "AthleteByName nil db")
+
+	athlete := Athlete{Name: name}
+	err := db.QueryRow(`SELECT id FROM athletes WHERE name = ?`, name).Scan(&athlete.ID)
+	if err == sql.ErrNoRows {
+		return athlete, fmt.Errorf("no athlete named %s; add one with `velora athlete add %s`", name, name)
+	}
+	if err != nil {
+		return athlete, fmt.Errorf("error reading athlete %s: %v", name, err)
+	}
+
+	return athlete, nil
+}
+
+func AllAthletes(db *sql.DB) ([]Athlete, error) {
+	util.Assert(db != nil, "AllAthletes nil db")
+
+	rows, err := db.Query(`SELECT id, name FROM athletes ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying athletes: %v", err)
+	}
+	defer rows.Close()
+
+	athletes := []Athlete{}
+	for rows.Next() {
+		var athlete Athlete
+		if err := rows.Scan(&athlete.ID, &athlete.Name); err != nil {
+			return nil, fmt.Errorf("error scanning athlete: %v", err)
+		}
+		athletes = append(athletes, athlete)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating athletes: %v", err)
+	}
+
+	return athletes, nil
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/vasilisp/velora/internal/util"
+)
+
+// Source is the command that changed an activity, as recorded in the audit
+// log.
+type Source uint
+
+const (
+	SourceAdd Source = iota
+	SourceFix
+	SourceEdit
+	SourceDelete
+	SourceImport
+	SourceRederive
+	SourceTrash
+)
+
+var sourceNames = []string{"add", "fix", "edit", "delete", "import", "rederive", "trash"}
+
+func (s Source) String() string {
+	util.Assert(s <= SourceTrash, "invalid source")
+	return sourceNames[s]
+}
+
+func SourceFromString(s string) (Source, error) {
+	for i, name := range sourceNames {
+		if strings.ToLower(s) == name {
+			return Source(i), nil
+		}
+	}
+	return SourceAdd, fmt.Errorf("invalid source: %s", s)
+}
+
+// AuditAction is the kind of change recorded in the audit log.
+type AuditAction uint
+
+const (
+	ActionInsert AuditAction = iota
+	ActionUpdate
+	ActionDelete
+	ActionRestore
+	ActionPurge
+)
+
+var auditActionNames = []string{"insert", "update", "delete", "restore", "purge"}
+
+func (a AuditAction) String() string {
+	util.Assert(a <= ActionPurge, "invalid audit action")
+	return auditActionNames[a]
+}
+
+func AuditActionFromString(s string) (AuditAction, error) {
+	for i, name := range auditActionNames {
+		if strings.ToLower(s) == name {
+			return AuditAction(i), nil
+		}
+	}
+	return ActionInsert, fmt.Errorf("invalid audit action: %s", s)
+}
+
+// AuditRecord is a single change to an activity. Old is nil for inserts and
+// restores, New is nil for deletes and purges.
+type AuditRecord struct {
+	ID         int64
+	ActivityID int64
+	Time       time.Time
+	Source     Source
+	Action     AuditAction
+	Old        *ActivityUnsafe
+	New        *ActivityUnsafe
+}
+
+func encodeAuditValue(activity *ActivityUnsafe) (any, error) {
+	if activity == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(activity)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding audit value: %v", err)
+	}
+
+	return string(data), nil
+}
+
+func decodeAuditValue(value sql.NullString) (*ActivityUnsafe, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+
+	var activity ActivityUnsafe
+	if err := json.Unmarshal([]byte(value.String), &activity); err != nil {
+		return nil, fmt.Errorf("error decoding audit value: %v", err)
+	}
+
+	return &activity, nil
+}
+
+// writeAudit records a change to an activity, as part of the transaction
+// making the change.
+func writeAudit(tx *sql.Tx, athleteID int64, activityID int64, source Source, action AuditAction, before *ActivityUnsafe, after *ActivityUnsafe) error {
+	oldValue, err := encodeAuditValue(before)
+	if err != nil {
+		return err
+	}
+
+	newValue, err := encodeAuditValue(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO activity_audit (athlete_id, activity_id, timestamp, source, action, old_value, new_value) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		athleteID, activityID, time.Now().Unix(), source.String(), action.String(), oldValue, newValue)
+	if err != nil {
+		return fmt.Errorf("error writing audit record: %v", err)
+	}
+
+	return nil
+}
+
+// AuditOf returns the audit records of an activity, oldest first. Records
+// outlive their activity, so purged activities still have a history.
+func AuditOf(db *sql.DB, athleteID int64, activityID int64) ([]AuditRecord, error) {
+	util.Assert(db != nil, "AuditOf nil db")
+
+	rows, err := db.Query(`
+		SELECT id, activity_id, timestamp, source, action, old_value, new_value
+		FROM activity_audit
+		WHERE athlete_id = ? AND activity_id = ?
+		ORDER BY id`, athleteID, activityID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit records: %v", err)
+	}
+	defer rows.Close()
+
+	records := []AuditRecord{}
+	for rows.Next() {
+		var record AuditRecord
+		var timestamp int64
+		var source, action string
+		var oldValue, newValue sql.NullString
+
+		if err := rows.Scan(&record.ID, &record.ActivityID, &timestamp, &source, &action, &oldValue, &newValue); err != nil {
+			return nil, fmt.Errorf("error scanning audit record: %v", err)
+		}
+
+		record.Time = time.Unix(timestamp, 0)
+
+		if record.Source, err = SourceFromString(source); err != nil {
+			return nil, err
+		}
+		if record.Action, err = AuditActionFromString(action); err != nil {
+			return nil, err
+		}
+		if record.Old, err = decodeAuditValue(oldValue); err != nil {
+			return nil, err
+		}
+		if record.New, err = decodeAuditValue(newValue); err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating audit records: %v", err)
+	}
+
+	return records, nil
+}
+
+// OutputTo writes a one-line summary of the record.
+func (r AuditRecord) OutputTo(w io.Writer) {
+	fmt.Fprintf(w, "%s  %-7s  via %s\n", r.Time.Format("2006-01-02 15:04"), r.Action, r.Source)
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/vasilisp/velora/internal/util"
+)
+
+// copyDatabase copies the main database of src over that of dst using
+// SQLite's online backup API, so src may be in use while it is copied.
+func copyDatabase(dst *sql.DB, src *sql.DB) error {
+	ctx := context.Background()
+
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return dstConn.Raw(func(dstDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			dstSQLite, ok := dstDriverConn.(*sqlite3.SQLiteConn)
+			util.Assert(ok, "copyDatabase non-sqlite destination")
+			srcSQLite, ok := srcDriverConn.(*sqlite3.SQLiteConn)
+			util.Assert(ok, "copyDatabase non-sqlite source")
+
+			backup, err := dstSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+
+			return backup.Finish()
+		})
+	})
+}
+
+// BackupTo writes a consistent snapshot of the database to a new SQLite file
+// at path.
+func BackupTo(db *sql.DB, path string) error {
+	util.Assert(db != nil, "BackupTo nil db")
+
+	dst, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return fmt.Errorf("error opening backup file: %v", err)
+	}
+	defer dst.Close()
+
+	if err := copyDatabase(dst, db); err != nil {
+		return fmt.Errorf("error backing up database: %v", err)
+	}
+
+	return nil
+}
+
+// RestoreFrom replaces the contents of the database at dbPath, open as db,
+// with the snapshot at snapshotPath, and migrates the result to the current
+// schema. Snapshots written by a newer binary are rejected up front.
+func RestoreFrom(db *sql.DB, dbPath string, snapshotPath string) error {
+	util.Assert(db != nil, "RestoreFrom nil db")
+
+	src, err := sql.Open("sqlite3", snapshotPath)
+	if err != nil {
+		return fmt.Errorf("error opening snapshot: %v", err)
+	}
+	defer src.Close()
+
+	version, err := schemaVersion(src)
+	if err != nil {
+		return err
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("snapshot schema version %d is newer than supported version %d; please upgrade velora", version, len(migrations))
+	}
+
+	if err := copyDatabase(db, src); err != nil {
+		return fmt.Errorf("error restoring database: %v", err)
+	}
+
+	return migrate(db, dbPath)
+}
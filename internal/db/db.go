@@ -5,72 +5,158 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"math"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/invopop/jsonschema"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/vasilisp/lingograph/extra"
 	"github.com/vasilisp/velora/internal/util"
 )
 
-type Sport uint
+type ActivityUnsafe struct {
+	ID              int64     `json:"id,omitempty" jsonschema_description:"The database id of the activity; leave unset for new activities"`
+	Time            time.Time `json:"time"`
+	Duration        int       `json:"duration" jsonschema_description:"The duration of the activity in seconds"`
+	DurationTotal   int       `json:"duration_total,omitempty" jsonschema_description:"The total duration of the activity in seconds, including rests"`
+	Distance        int       `json:"distance" jsonschema_description:"The distance of the activity in meters"`
+	Sport           string    `json:"sport" jsonschema_description:"The sport of the activity"`
+	VerticalGain    int       `json:"vertical_gain" jsonschema_description:"The total vertical gain in meters"`
+	Notes           string    `json:"notes" jsonschema_description:"User-provided notes for the activity"`
+	WasRecommended  bool      `json:"was_recommended" jsonschema_description:"Whether the activity was recommended by the system"`
+	Segments        []Segment `json:"segments" jsonschema_description:"The segments of the activity; should be empty for non-structured activities"`
+	AvgHeartRate    int       `json:"avg_heart_rate,omitempty" jsonschema_description:"The average heart rate in beats per minute, if known"`
+	MaxHeartRate    int       `json:"max_heart_rate,omitempty" jsonschema_description:"The maximum heart rate in beats per minute, if known"`
+	TimeInZones     []int     `json:"time_in_zones,omitempty" jsonschema_description:"Seconds spent in each heart rate zone, starting from zone 1 (at most 5 entries), if known"`
+	AvgPower        int       `json:"avg_power,omitempty" jsonschema_description:"The average power in Watts, if known"`
+	NormPower       int       `json:"normalized_power,omitempty" jsonschema_description:"The normalized power in Watts, if known"`
+	Work            int       `json:"work,omitempty" jsonschema_description:"The total work in kilojoules, if known"`
+	IntensityFactor float64   `json:"intensity_factor,omitempty" jsonschema_description:"Intensity Factor derived from power and FTP; computed by the system, leave unset"`
+	TSS             float64   `json:"tss,omitempty" jsonschema_description:"Training Stress Score derived from power and FTP; computed by the system, leave unset"`
+	RPE             int       `json:"rpe,omitempty" jsonschema_description:"Session rating of perceived exertion on a 1-10 scale, if known"`
+	GearID          int64     `json:"gear_id,omitempty" jsonschema_description:"The id of the bike or shoes used, from the user's gear list; leave unset if not mentioned"`
+	GearName        string    `json:"gear_name,omitempty" jsonschema_description:"The name of the gear used; filled in by the system, leave unset"`
+	Surface         string    `json:"surface,omitempty" jsonschema:"enum=road,enum=gravel,enum=trail,enum=track" jsonschema_description:"The main surface (road, gravel, trail, or track), if known"`
+	Indoor          bool      `json:"indoor,omitempty" jsonschema_description:"Whether the activity was indoors (treadmill, indoor trainer, indoor pool)"`
+	Urban           bool      `json:"urban,omitempty" jsonschema_description:"Whether the activity was in an urban setting with frequent stops"`
+	WindSpeed       int       `json:"wind_speed,omitempty" jsonschema_description:"The wind speed in km/h, if known"`
+	Temperature     *int      `json:"temperature,omitempty" jsonschema_description:"The air temperature in degrees Celsius, if known"`
+	Laps            []Lap     `json:"laps,omitempty" jsonschema_description:"The laps or splits of the activity in order, if known; leave empty otherwise"`
+	// Track is the encoded GPS and sensor stream of an imported activity. It
+	// is never shown to the model, and is only written when not nil, so that
+	// edits keep the stored track.
+	Track []byte `json:"-"`
+}
 
-const (
-	Running Sport = iota
-	Cycling
-	Swimming
-)
+var Surfaces = []string{"road", "gravel", "trail", "track"}
 
-func (s Sport) String() string {
-	util.Assert(s >= Running && s <= Swimming, "invalid sport")
-	return []string{"running", "cycling", "swimming"}[s]
+// JSONSchemaExtend restricts the sport to the registered sports.
+func (ActivityUnsafe) JSONSchemaExtend(schema *jsonschema.Schema) {
+	if sport, ok := schema.Properties.Get("sport"); ok {
+		sport.Enum = sportNames()
+	}
 }
 
-func SportFromString(s string) (Sport, error) {
-	switch strings.ToLower(s) {
-	case "running":
-		return Running, nil
-	case "cycling":
-		return Cycling, nil
-	case "swimming":
-		return Swimming, nil
-	default:
-		return Running, fmt.Errorf("invalid sport: %s", s)
+// DerivePowerMetrics fills in work, Intensity Factor and TSS from the power
+// data of a cycling activity, given the athlete's FTP in Watts.
+func (a *ActivityUnsafe) DerivePowerMetrics(ftp uint) {
+	util.Assert(a != nil, "DerivePowerMetrics nil activity")
+
+	if a.Work == 0 && a.AvgPower > 0 {
+		a.Work = int(math.Round(float64(a.AvgPower) * float64(a.Duration) / 1000))
 	}
-}
 
-type Segment struct {
-	Repeat   int `json:"repeat" jsonschema_description:"The number of times to repeat the segment. Can be 1."`
-	Distance int `json:"distance" jsonschema_description:"The planned distance in meters"`
-	Zone     int `json:"zone" jsonschema_description:"The planned zone (1-5)"`
+	a.IntensityFactor = 0
+	a.TSS = 0
+
+	power := a.NormPower
+	if power == 0 {
+		power = a.AvgPower
+	}
+
+	if ftp == 0 || power <= 0 || a.Duration <= 0 || !strings.EqualFold(a.Sport, Cycling.String()) {
+		return
+	}
+
+	intensityFactor := float64(power) / float64(ftp)
+	a.IntensityFactor = math.Round(intensityFactor*100) / 100
+	a.TSS = math.Round(float64(a.Duration)*intensityFactor*intensityFactor/3600*100*10) / 10
 }
 
-type ActivityUnsafe struct {
-	Time           time.Time `json:"time"`
-	Duration       int       `json:"duration" jsonschema_description:"The duration of the activity in seconds"`
-	DurationTotal  int       `json:"duration_total,omitempty" jsonschema_description:"The total duration of the activity in seconds, including rests"`
-	Distance       int       `json:"distance" jsonschema_description:"The distance of the activity in meters"`
-	Sport          string    `json:"sport" jsonschema_description:"The sport of the activity (running, cycling, or swimming)"`
-	VerticalGain   int       `json:"vertical_gain" jsonschema_description:"The total vertical gain in meters"`
-	Notes          string    `json:"notes" jsonschema_description:"User-provided notes for the activity"`
-	WasRecommended bool      `json:"was_recommended" jsonschema_description:"Whether the activity was recommended by the system"`
-	Segments       []Segment `json:"segments" jsonschema_description:"The segments of the activity; should be empty for non-structured activities"`
-}
-
-func outputSegmentsTo(w io.Writer, segments []Segment) {
-	for i, segment := range segments {
+func outputHeartRateTo(w io.Writer, a *ActivityUnsafe) {
+	switch {
+	case a.AvgHeartRate > 0 && a.MaxHeartRate > 0:
+		fmt.Fprintf(w, "Heart Rate: %dbpm avg, %dbpm max\n", a.AvgHeartRate, a.MaxHeartRate)
+	case a.AvgHeartRate > 0:
+		fmt.Fprintf(w, "Heart Rate: %dbpm avg\n", a.AvgHeartRate)
+	case a.MaxHeartRate > 0:
+		fmt.Fprintf(w, "Heart Rate: %dbpm max\n", a.MaxHeartRate)
+	}
+
+	if len(a.TimeInZones) == 0 {
+		return
+	}
+
+	fmt.Fprint(w, "Time in Zones:")
+	for i, seconds := range a.TimeInZones {
 		if i > 0 {
-			fmt.Fprint(w, ", ")
+			fmt.Fprint(w, ",")
 		}
-		fmt.Fprintf(w, "  - Repeat: %d, Distance: %d, Zone: %d\n", segment.Repeat, segment.Distance, segment.Zone)
+		fmt.Fprintf(w, " Z%d %s", i+1, util.FormatDuration(seconds))
+	}
+	fmt.Fprintln(w)
+}
+
+func outputPowerTo(w io.Writer, a *ActivityUnsafe) {
+	parts := []string{}
+	if a.AvgPower > 0 {
+		parts = append(parts, fmt.Sprintf("%dW avg", a.AvgPower))
+	}
+	if a.NormPower > 0 {
+		parts = append(parts, fmt.Sprintf("%dW NP", a.NormPower))
+	}
+	if a.Work > 0 {
+		parts = append(parts, fmt.Sprintf("%dkJ", a.Work))
+	}
+	if len(parts) > 0 {
+		fmt.Fprintf(w, "Power: %s\n", strings.Join(parts, ", "))
+	}
+
+	if a.TSS > 0 {
+		fmt.Fprintf(w, "Intensity Factor: %.2f, TSS: %.0f\n", a.IntensityFactor, a.TSS)
+	}
+}
+
+func outputConditionsTo(w io.Writer, a *ActivityUnsafe) {
+	parts := []string{}
+	if a.Surface != "" {
+		parts = append(parts, a.Surface)
+	}
+	if a.Indoor {
+		parts = append(parts, "indoor")
+	}
+	if a.Urban {
+		parts = append(parts, "urban")
+	}
+	if a.WindSpeed > 0 {
+		parts = append(parts, fmt.Sprintf("wind %dkm/h", a.WindSpeed))
+	}
+	if a.Temperature != nil {
+		parts = append(parts, fmt.Sprintf("%d°C", *a.Temperature))
+	}
+	if len(parts) > 0 {
+		fmt.Fprintf(w, "Conditions: %s\n", strings.Join(parts, ", "))
 	}
 }
 
 func (a *ActivityUnsafe) OutputTo(w io.Writer) {
 	util.Assert(a != nil, "OutputTo nil activity")
 
+	if a.ID > 0 {
+		fmt.Fprintf(w, "ID: %d\n", a.ID)
+	}
 	fmt.Fprintf(w, "Date: %s\nSport: %s\nTime: %s\nDistance: %s\nVertical Gain: %dm\nNotes: %s\n",
 		a.Time.Format("Jan 2, 15:04"),
 		a.Sport,
@@ -79,7 +165,17 @@ func (a *ActivityUnsafe) OutputTo(w io.Writer) {
 		a.VerticalGain,
 		extra.SanitizeOutputString(a.Notes, true),
 	)
-	outputSegmentsTo(w, a.Segments)
+	if a.RPE > 0 {
+		fmt.Fprintf(w, "RPE: %d/10\n", a.RPE)
+	}
+	if a.GearName != "" {
+		fmt.Fprintf(w, "Gear: %s\n", a.GearName)
+	}
+	outputConditionsTo(w, a)
+	outputHeartRateTo(w, a)
+	outputPowerTo(w, a)
+	OutputSegmentsTo(w, "", a.Segments)
+	outputLapsTo(w, a.Laps)
 }
 
 type activity struct {
@@ -101,7 +197,9 @@ func (a ActivityUnsafe) ToActivity() (activity, error) {
 		err = fmt.Errorf("duration must be positive")
 	}
 
-	if a.Distance <= 0 {
+	info := sport.Info()
+
+	if a.Distance < 0 || (a.Distance == 0 && info.Measure == ByDistance) {
 		err = fmt.Errorf("distance must be positive")
 	}
 
@@ -109,105 +207,450 @@ func (a ActivityUnsafe) ToActivity() (activity, error) {
 		err = fmt.Errorf("verticalGain must be non-negative")
 	}
 
+	if a.VerticalGain > 0 && !info.Has(MetricVerticalGain) {
+		err = fmt.Errorf("vertical gain is not tracked for %s", sport)
+	}
+
+	if (a.AvgHeartRate > 0 || a.MaxHeartRate > 0 || len(a.TimeInZones) > 0) && !info.Has(MetricHeartRate) {
+		err = fmt.Errorf("heart rate is not tracked for %s", sport)
+	}
+
+	if (a.AvgPower > 0 || a.NormPower > 0 || a.Work > 0) && !info.Has(MetricPower) {
+		err = fmt.Errorf("power is not tracked for %s", sport)
+	}
+
+	if a.Surface != "" && !info.Has(MetricSurface) {
+		err = fmt.Errorf("surface is not tracked for %s", sport)
+	}
+
+	for _, segment := range a.Segments {
+		if segmentErr := segment.validate(info); segmentErr != nil {
+			err = segmentErr
+		}
+	}
+
+	if lapsErr := validateLaps(&a, info); lapsErr != nil {
+		err = lapsErr
+	}
+
+	if a.AvgHeartRate < 0 || a.MaxHeartRate < 0 {
+		err = fmt.Errorf("heart rate must be non-negative")
+	}
+
+	if a.AvgHeartRate > 0 && a.MaxHeartRate > 0 && a.AvgHeartRate > a.MaxHeartRate {
+		err = fmt.Errorf("average heart rate cannot exceed maximum heart rate")
+	}
+
+	if len(a.TimeInZones) > 5 {
+		err = fmt.Errorf("at most 5 heart rate zones are supported")
+	}
+
+	for _, seconds := range a.TimeInZones {
+		if seconds < 0 {
+			err = fmt.Errorf("time in zones must be non-negative")
+		}
+	}
+
+	if a.AvgPower < 0 || a.NormPower < 0 || a.Work < 0 {
+		err = fmt.Errorf("power and work must be non-negative")
+	}
+
+	if a.IntensityFactor < 0 || a.TSS < 0 {
+		err = fmt.Errorf("intensity factor and TSS must be non-negative")
+	}
+
+	if a.RPE < 0 || a.RPE > 10 {
+		err = fmt.Errorf("RPE must be between 1 and 10")
+	}
+
+	if a.Surface != "" && !slices.Contains(Surfaces, a.Surface) {
+		err = fmt.Errorf("invalid surface: %s", a.Surface)
+	}
+
+	if a.WindSpeed < 0 {
+		err = fmt.Errorf("wind speed must be non-negative")
+	}
+
 	return activity{a: a, sport: sport}, err
 }
 
-func LastActivities(db *sql.DB, limit int) ([]ActivityUnsafe, error) {
+const activityColumns = `id, timestamp, duration, duration_total, sport, distance, vertical_gain, notes, was_recommended, segments,
+	avg_heart_rate, max_heart_rate, time_in_zones, avg_power, normalized_power, work, intensity_factor, tss, rpe,
+	gear_id, (SELECT name FROM gear WHERE gear.id = activities.gear_id), surface, indoor, urban, wind_speed, temperature`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func scanActivity(row scanner) (ActivityUnsafe, error) {
+	var activity ActivityUnsafe
+	var verticalGain, avgHeartRate, maxHeartRate, avgPower, normPower, work, rpe sql.NullInt64
+	var intensityFactor, tss sql.NullFloat64
+	var gearID, windSpeed, temperature sql.NullInt64
+	var gearName, surface sql.NullString
+	var segmentsBytes, timeInZonesBytes []byte
+
+	err := row.Scan(&activity.ID, &activity.Time, &activity.Duration, &activity.DurationTotal, &activity.Sport, &activity.Distance, &verticalGain, &activity.Notes, &activity.WasRecommended, &segmentsBytes,
+		&avgHeartRate, &maxHeartRate, &timeInZonesBytes, &avgPower, &normPower, &work, &intensityFactor, &tss, &rpe,
+		&gearID, &gearName, &surface, &activity.Indoor, &activity.Urban, &windSpeed, &temperature)
+	if err != nil {
+		return activity, err
+	}
+
+	activity.VerticalGain = int(verticalGain.Int64)
+	activity.AvgHeartRate = int(avgHeartRate.Int64)
+	activity.MaxHeartRate = int(maxHeartRate.Int64)
+	activity.AvgPower = int(avgPower.Int64)
+	activity.NormPower = int(normPower.Int64)
+	activity.Work = int(work.Int64)
+	activity.IntensityFactor = intensityFactor.Float64
+	activity.TSS = tss.Float64
+	activity.RPE = int(rpe.Int64)
+	activity.GearID = gearID.Int64
+	activity.GearName = gearName.String
+	activity.Surface = surface.String
+	activity.WindSpeed = int(windSpeed.Int64)
+	if temperature.Valid {
+		t := int(temperature.Int64)
+		activity.Temperature = &t
+	}
+
+	if len(timeInZonesBytes) > 0 {
+		err = json.Unmarshal(timeInZonesBytes, &activity.TimeInZones)
+		if err != nil {
+			return activity, fmt.Errorf("error unmarshalling time in zones: %v", err)
+		}
+	}
+
+	if len(segmentsBytes) > 0 {
+		var segments []Segment
+		err = json.Unmarshal(segmentsBytes, &segments)
+		if err != nil {
+			return activity, fmt.Errorf("error unmarshalling segments: %v", err)
+		}
+		activity.Segments = segments
+	}
+
+	return activity, nil
+}
+
+func LastActivities(db *sql.DB, athleteID int64, limit int) ([]ActivityUnsafe, error) {
 	util.Assert(limit > 0, "LastActivities non-positive limit")
 	util.Assert(db != nil, "LastActivities nil db")
 
-	rows, err := db.Query(`
-		SELECT timestamp, duration, duration_total, sport, distance, vertical_gain, notes, was_recommended, segments
-		FROM activities
-		ORDER BY timestamp DESC
-		LIMIT ?`, limit)
+	return QueryActivities(db, ActivityFilter{AthleteID: athleteID, Limit: limit})
+}
+
+func ActivityByID(db *sql.DB, athleteID int64, id int64) (ActivityUnsafe, error) {
+	util.Assert(db != nil, "ActivityByID nil db")
+
+	return activityByID(db, athleteID, id, false)
+}
+
+// activityByID reads an activity with its laps, either from the live
+// activities or from the trash.
+func activityByID(q querier, athleteID int64, id int64, trashed bool) (ActivityUnsafe, error) {
+	condition, missing := "deleted_at IS NULL", fmt.Errorf("no activity with id %d", id)
+	if trashed {
+		condition, missing = "deleted_at IS NOT NULL", fmt.Errorf("no activity with id %d in the trash", id)
+	}
+
+	row := q.QueryRow(`SELECT `+activityColumns+` FROM activities WHERE id = ? AND athlete_id = ? AND `+condition, id, athleteID)
+	activity, err := scanActivity(row)
+	if err == sql.ErrNoRows {
+		return activity, missing
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error querying activities: %v", err)
+		return activity, fmt.Errorf("error reading activity %d: %v", id, err)
 	}
-	defer rows.Close()
 
-	activities := []ActivityUnsafe{}
-	for rows.Next() {
-		var activity ActivityUnsafe
-		var verticalGain sql.NullInt64
-		var segmentsBytes []byte
+	activity.Laps, err = lapsOf(q, id)
+	return activity, err
+}
 
-		err := rows.Scan(&activity.Time, &activity.Duration, &activity.DurationTotal, &activity.Sport, &activity.Distance, &verticalGain, &activity.Notes, &activity.WasRecommended, &segmentsBytes)
+func Init(dbPath string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %v", err)
+	}
+
+	err = migrate(db, dbPath)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err := loadSports(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func nullInt(v int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(v), Valid: v != 0}
+}
+
+func nullFloat(v float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: v, Valid: v != 0}
+}
+
+// columns returns the writable columns of the activities table together with
+// the values to store in them.
+func (activity activity) columns() ([]string, []any, error) {
+	segments, err := json.Marshal(activity.a.Segments)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error marshalling segments: %v", err)
+	}
+
+	var timeInZones []byte
+	if len(activity.a.TimeInZones) > 0 {
+		timeInZones, err = json.Marshal(activity.a.TimeInZones)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning activity: %v", err)
+			return nil, nil, fmt.Errorf("error marshalling time in zones: %v", err)
 		}
+	}
 
-		if verticalGain.Valid {
-			activity.VerticalGain = int(verticalGain.Int64)
-		}
+	temperature := sql.NullInt64{}
+	if activity.a.Temperature != nil {
+		temperature = sql.NullInt64{Int64: int64(*activity.a.Temperature), Valid: true}
+	}
+
+	names := []string{
+		"timestamp", "duration", "duration_total", "sport", "distance", "vertical_gain", "notes", "was_recommended", "segments",
+		"avg_heart_rate", "max_heart_rate", "time_in_zones",
+		"avg_power", "normalized_power", "work", "intensity_factor", "tss",
+		"rpe", "gear_id",
+		"surface", "indoor", "urban", "wind_speed", "temperature",
+	}
+	values := []any{
+		activity.a.Time.Unix(), activity.a.Duration, activity.a.DurationTotal, activity.sport.String(), activity.a.Distance, nullInt(activity.a.VerticalGain), activity.a.Notes, activity.a.WasRecommended, segments,
+		nullInt(activity.a.AvgHeartRate), nullInt(activity.a.MaxHeartRate), timeInZones,
+		nullInt(activity.a.AvgPower), nullInt(activity.a.NormPower), nullInt(activity.a.Work), nullFloat(activity.a.IntensityFactor), nullFloat(activity.a.TSS),
+		nullInt(activity.a.RPE), sql.NullInt64{Int64: activity.a.GearID, Valid: activity.a.GearID != 0},
+		sql.NullString{String: activity.a.Surface, Valid: activity.a.Surface != ""}, activity.a.Indoor, activity.a.Urban, nullInt(activity.a.WindSpeed), temperature,
+	}
+	util.Assert(len(names) == len(values), "activity columns mismatch")
+
+	return names, values, nil
+}
 
-		if len(segmentsBytes) > 0 {
-			var segments []Segment
-			err = json.Unmarshal(segmentsBytes, &segments)
-			if err != nil {
-				return nil, fmt.Errorf("error unmarshalling segments: %v", err)
-			}
-			activity.Segments = segments
+// InsertActivity stores a new activity, and records it in the audit log as
+// coming from source. Retired gear is rejected; it can still be set with edit.
+func InsertActivity(db *sql.DB, athleteID int64, activity activity, source Source) error {
+	if activity.a.GearID == 0 {
+		gearID, err := DefaultGearID(db, athleteID, activity.sport)
+		if err != nil {
+			return fmt.Errorf("error looking up default gear: %v", err)
 		}
+		activity.a.GearID = gearID
+	}
 
-		activities = append(activities, activity)
+	if err := checkGear(db, athleteID, activity, false); err != nil {
+		return err
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating activities: %v", err)
+	names, values, err := activity.columns()
+	if err != nil {
+		return err
+	}
+
+	names = append(names, "athlete_id")
+	values = append(values, athleteID)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	result, err := tx.Exec(`INSERT INTO activities (`+strings.Join(names, ", ")+`) VALUES (`+placeholders+`)`, values...)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
 	}
 
-	return activities, nil
+	if err := replaceLaps(tx, id, activity.a.Laps); err != nil {
+		return err
+	}
+
+	if err := storeTrack(tx, id, activity.a.Track); err != nil {
+		return err
+	}
+
+	inserted, err := activityByID(tx, athleteID, id, false)
+	if err != nil {
+		return err
+	}
+
+	if err := writeAudit(tx, athleteID, id, source, ActionInsert, nil, &inserted); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func Init() (*sql.DB, error) {
-	homeDir, err := os.UserHomeDir()
+// UpdateActivity overwrites a live activity, and records the old and new
+// versions in the audit log. Retired gear is accepted if the activity already
+// had it, or if the user picked it in the editor.
+func UpdateActivity(db *sql.DB, athleteID int64, id int64, activity activity, source Source) error {
+	tx, err := db.Begin()
 	if err != nil {
-		util.Fatalf("cannot locate home directory: %v", err)
+		return err
 	}
+	defer tx.Rollback()
 
-	dotDir := filepath.Join(homeDir, ".velora")
-	if os.MkdirAll(dotDir, 0755) != nil {
-		util.Fatalf("cannot create .velora directory: %v", err)
+	if err := updateActivity(tx, athleteID, id, activity, source); err != nil {
+		return err
 	}
 
-	dbPath := filepath.Join(dotDir, "velora.sqlite")
-	db, err := sql.Open("sqlite3", dbPath)
+	return tx.Commit()
+}
+
+// UpdateActivities overwrites several live activities, identified by their
+// IDs, like UpdateActivity. Either all of them are updated or none is.
+func UpdateActivities(db *sql.DB, athleteID int64, activities []ActivityUnsafe, source Source) error {
+	tx, err := db.Begin()
 	if err != nil {
-		util.Fatalf("error opening database: %v", err)
+		return err
 	}
+	defer tx.Rollback()
 
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS activities (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp DATETIME NOT NULL CHECK(timestamp = CAST(timestamp AS INTEGER)),
-		duration INTEGER NOT NULL,
-		duration_total INTEGER NOT NULL,
-		sport TEXT CHECK (sport IN ('running', 'cycling', 'swimming')) NOT NULL,
-		distance INTEGER NOT NULL,
-		vertical_gain INTEGER,
-		notes TEXT,
-		was_recommended BOOLEAN NOT NULL DEFAULT FALSE,
-		segments TEXT
-	)`)
+	for _, activity := range activities {
+		util.Assert(activity.ID != 0, "UpdateActivities activity without id")
+
+		activitySafe, err := activity.ToActivity()
+		if err != nil {
+			return fmt.Errorf("activity %d: %v", activity.ID, err)
+		}
+
+		if err := updateActivity(tx, athleteID, activity.ID, activitySafe, source); err != nil {
+			return fmt.Errorf("error updating activity %d: %v", activity.ID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func updateActivity(tx *sql.Tx, athleteID int64, id int64, activity activity, source Source) error {
+	names, values, err := activity.columns()
 	if err != nil {
-		return nil, fmt.Errorf("error creating activities table: %v", err)
+		return err
 	}
 
-	return db, nil
+	assignments := make([]string, len(names))
+	for i, name := range names {
+		assignments[i] = name + " = ?"
+	}
+
+	before, err := activityByID(tx, athleteID, id, false)
+	if err != nil {
+		return err
+	}
+
+	allowRetired := activity.a.GearID == before.GearID || source == SourceEdit
+	if err := checkGear(tx, athleteID, activity, allowRetired); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`UPDATE activities SET `+strings.Join(assignments, ", ")+` WHERE id = ? AND athlete_id = ? AND deleted_at IS NULL`, append(values, id, athleteID)...)
+	if err != nil {
+		return err
+	}
+
+	if err := expectOneRow(result, id); err != nil {
+		return err
+	}
+
+	if err := replaceLaps(tx, id, activity.a.Laps); err != nil {
+		return err
+	}
+
+	if err := storeTrack(tx, id, activity.a.Track); err != nil {
+		return err
+	}
+
+	after, err := activityByID(tx, athleteID, id, false)
+	if err != nil {
+		return err
+	}
+
+	return writeAudit(tx, athleteID, id, source, ActionUpdate, &before, &after)
+}
+
+// DeleteActivity moves an activity to the trash, from where it can be
+// restored or purged.
+func DeleteActivity(db *sql.DB, athleteID int64, id int64, source Source) error {
+	return moveActivity(db, athleteID, id, false, func(tx *sql.Tx, activity ActivityUnsafe) error {
+		if _, err := tx.Exec(`UPDATE activities SET deleted_at = ? WHERE id = ?`, time.Now().Unix(), id); err != nil {
+			return err
+		}
+		return writeAudit(tx, athleteID, id, source, ActionDelete, &activity, nil)
+	})
+}
+
+// RestoreActivity brings an activity back from the trash.
+func RestoreActivity(db *sql.DB, athleteID int64, id int64) error {
+	return moveActivity(db, athleteID, id, true, func(tx *sql.Tx, activity ActivityUnsafe) error {
+		if _, err := tx.Exec(`UPDATE activities SET deleted_at = NULL WHERE id = ?`, id); err != nil {
+			return err
+		}
+		return writeAudit(tx, athleteID, id, SourceTrash, ActionRestore, nil, &activity)
+	})
+}
+
+// PurgeActivity permanently deletes an activity in the trash, along with its
+// laps and track. Its audit records are kept.
+func PurgeActivity(db *sql.DB, athleteID int64, id int64) error {
+	return moveActivity(db, athleteID, id, true, func(tx *sql.Tx, activity ActivityUnsafe) error {
+		if _, err := tx.Exec(`DELETE FROM activities WHERE id = ?`, id); err != nil {
+			return err
+		}
+		return writeAudit(tx, athleteID, id, SourceTrash, ActionPurge, &activity, nil)
+	})
 }
 
-func InsertActivity(db *sql.DB, activity activity) error {
-	verticalGain := int64(activity.a.VerticalGain)
-	if verticalGain == 0 {
-		verticalGain = sql.NullInt64{Valid: false}.Int64
+// moveActivity applies change to a live or trashed activity in a transaction.
+func moveActivity(db *sql.DB, athleteID int64, id int64, trashed bool, change func(tx *sql.Tx, activity ActivityUnsafe) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	segments, err := json.Marshal(activity.a.Segments)
+	activity, err := activityByID(tx, athleteID, id, trashed)
+	if err != nil {
+		return err
+	}
+
+	if err := change(tx, activity); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func expectOneRow(result sql.Result, id int64) error {
+	n, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("error marshalling segments: %v", err)
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("no activity with id %d", id)
 	}
 
-	_, err = db.Exec(`INSERT INTO activities (timestamp, duration, duration_total, sport, distance, vertical_gain, notes, was_recommended, segments) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		activity.a.Time.Unix(), activity.a.Duration, activity.a.DurationTotal, activity.sport.String(), activity.a.Distance, verticalGain, activity.a.Notes, activity.a.WasRecommended, segments)
-	return err
+	return nil
 }
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/vasilisp/velora/internal/util"
+)
+
+// IntegrityCheck runs SQLite's integrity check and returns the problems it
+// reports; an empty result means the database is sound.
+func IntegrityCheck(db *sql.DB) ([]string, error) {
+	util.Assert(db != nil, "IntegrityCheck nil db")
+
+	rows, err := db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return nil, fmt.Errorf("error checking integrity: %v", err)
+	}
+	defer rows.Close()
+
+	problems := []string{}
+	for rows.Next() {
+		var message string
+		if err := rows.Scan(&message); err != nil {
+			return nil, fmt.Errorf("error scanning integrity check: %v", err)
+		}
+		if message != "ok" {
+			problems = append(problems, message)
+		}
+	}
+
+	return problems, rows.Err()
+}
+
+type InvalidActivity struct {
+	ID  int64
+	Err error
+}
+
+// InvalidActivities returns the stored activities of all athletes that could
+// not be read or that would be rejected if they were inserted today.
+func InvalidActivities(db *sql.DB) ([]InvalidActivity, error) {
+	util.Assert(db != nil, "InvalidActivities nil db")
+
+	athletes, err := AllAthletes(db)
+	if err != nil {
+		return nil, err
+	}
+
+	invalid := []InvalidActivity{}
+	for _, athlete := range athletes {
+		invalidOfAthlete, err := invalidActivitiesOf(db, athlete.ID)
+		if err != nil {
+			return nil, err
+		}
+		invalid = append(invalid, invalidOfAthlete...)
+	}
+
+	return invalid, nil
+}
+
+// invalidActivitiesOf checks the live activities of an athlete, with their
+// laps; activities in the trash are left out.
+func invalidActivitiesOf(db *sql.DB, athleteID int64) ([]InvalidActivity, error) {
+	laps, err := LapsSince(db, athleteID, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT `+activityColumns+` FROM activities WHERE athlete_id = ? AND deleted_at IS NULL ORDER BY id`, athleteID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying activities: %v", err)
+	}
+	defer rows.Close()
+
+	invalid := []InvalidActivity{}
+	for rows.Next() {
+		activityUnsafe, err := scanActivity(rows)
+		if err != nil {
+			invalid = append(invalid, InvalidActivity{ID: activityUnsafe.ID, Err: err})
+			continue
+		}
+
+		activityUnsafe.Laps = laps[activityUnsafe.ID]
+
+		activity, err := activityUnsafe.ToActivity()
+		if err == nil {
+			err = checkGear(db, athleteID, activity, true)
+		}
+		if err != nil {
+			invalid = append(invalid, InvalidActivity{ID: activityUnsafe.ID, Err: err})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating activities: %v", err)
+	}
+
+	return invalid, nil
+}
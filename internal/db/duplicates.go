@@ -0,0 +1,61 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/vasilisp/velora/internal/util"
+)
+
+const (
+	// activities starting this close together, in seconds, are compared by
+	// distance and duration
+	duplicateTimeTolerance = 3600
+	// relative difference in distance and duration under which activities
+	// count as near-identical
+	duplicateRelativeTolerance = 0.05
+)
+
+// Duplicates returns the stored activities of the same sport that overlap the
+// given activity in time, or whose timestamp, distance and duration are
+// near-identical to it. Closest matches come first.
+func Duplicates(db *sql.DB, athleteID int64, activity activity) ([]ActivityUnsafe, error) {
+	util.Assert(db != nil, "Duplicates nil db")
+
+	start := activity.a.Time.Unix()
+	end := start + int64(activity.a.DurationTotal)
+
+	rows, err := db.Query(`
+		SELECT `+activityColumns+`
+		FROM activities
+		WHERE athlete_id = ? AND sport = ? AND deleted_at IS NULL AND (
+			(timestamp < ? AND timestamp + duration_total > ?)
+			OR (ABS(timestamp - ?) <= ? AND ABS(distance - ?) <= ? * ? AND ABS(duration - ?) <= ? * ?)
+		)
+		ORDER BY ABS(timestamp - ?)`,
+		athleteID, activity.sport.String(),
+		end, start,
+		start, duplicateTimeTolerance,
+		activity.a.Distance, activity.a.Distance, duplicateRelativeTolerance,
+		activity.a.Duration, activity.a.Duration, duplicateRelativeTolerance,
+		start)
+	if err != nil {
+		return nil, fmt.Errorf("error querying duplicates: %v", err)
+	}
+	defer rows.Close()
+
+	duplicates := []ActivityUnsafe{}
+	for rows.Next() {
+		duplicate, err := scanActivity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning activity: %v", err)
+		}
+		duplicates = append(duplicates, duplicate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating activities: %v", err)
+	}
+
+	return duplicates, nil
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// fts5Available tells whether SQLite has FTS5, which go-sqlite3 only compiles
+// in with the sqlite_fts5 build tag.
+func fts5Available(q querier) (bool, error) {
+	var available bool
+	err := q.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&available)
+	return available, err
+}
+
+// searchError turns the error of a malformed full-text query into one
+// explaining the syntax, and returns nil for other errors. SQLite reports such
+// errors either when preparing the query or when stepping through it.
+func searchError(text string, err error) error {
+	message := err.Error()
+	for _, s := range []string{"fts5: syntax error", "unterminated string", "malformed MATCH expression"} {
+		if text != "" && strings.Contains(message, s) {
+			return fmt.Errorf(`invalid search query %q; use words, "quoted phrases", prefixes (knee*), AND, OR and NOT`, text)
+		}
+	}
+	return nil
+}
+
+// notesIndexTriggers returns the statements creating the triggers that keep
+// the full-text index in sync with the activities table.
+func notesIndexTriggers() []string {
+	return []string{
+		`CREATE TRIGGER activities_fts_after_delete AFTER DELETE ON activities BEGIN
+			INSERT INTO activities_fts (activities_fts, rowid, notes) VALUES ('delete', old.id, old.notes);
+		END`,
+		`CREATE TRIGGER activities_fts_after_update AFTER UPDATE OF notes ON activities BEGIN
+			INSERT INTO activities_fts (activities_fts, rowid, notes) VALUES ('delete', old.id, old.notes);
+			INSERT INTO activities_fts (rowid, notes) VALUES (new.id, new.notes);
+		END`,
+		`CREATE TRIGGER activities_fts_after_insert AFTER INSERT ON activities BEGIN
+			INSERT INTO activities_fts (rowid, notes) VALUES (new.id, new.notes);
+		END`,
+	}
+}
+
+// notesIndexExists tells whether the full-text index has been created, which
+// builds without FTS5 skip.
+func notesIndexExists(q querier) (bool, error) {
+	var count int
+	err := q.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'activities_fts'`).Scan(&count)
+	return count > 0, err
+}
+
+// createNotesIndex creates the full-text index over activity notes and the
+// triggers keeping it in sync. Without FTS5 it does nothing, and the index is
+// created by the first search of a build that has FTS5.
+func createNotesIndex(tx *sql.Tx) error {
+	available, err := fts5Available(tx)
+	if err != nil || !available {
+		return err
+	}
+
+	statements := []string{`CREATE VIRTUAL TABLE activities_fts USING fts5(notes, content='activities', content_rowid='id')`}
+	statements = append(statements, notesIndexTriggers()...)
+	statements = append(statements, `INSERT INTO activities_fts (activities_fts) VALUES ('rebuild')`)
+
+	return execMigration(statements...)(tx)
+}
+
+// ensureNotesIndex checks that note search is possible, creating the
+// full-text index if the database was created by a build without FTS5.
+func ensureNotesIndex(db *sql.DB) error {
+	available, err := fts5Available(db)
+	if err != nil {
+		return fmt.Errorf("error checking for FTS5: %v", err)
+	}
+	if !available {
+		return fmt.Errorf("searching notes needs SQLite with FTS5; rebuild velora with: go build -tags sqlite_fts5 ./cmd/velora")
+	}
+
+	exists, err := notesIndexExists(db)
+	if err != nil || exists {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := createNotesIndex(tx); err != nil {
+		return fmt.Errorf("error creating the notes index: %v", err)
+	}
+
+	return tx.Commit()
+}
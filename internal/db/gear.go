@@ -0,0 +1,259 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/vasilisp/velora/internal/util"
+)
+
+type GearKind uint
+
+const (
+	Bike GearKind = iota
+	Shoes
+)
+
+func (k GearKind) String() string {
+	util.Assert(k >= Bike && k <= Shoes, "invalid gear kind")
+	return []string{"bike", "shoes"}[k]
+}
+
+func GearKindFromString(s string) (GearKind, error) {
+	switch strings.ToLower(s) {
+	case "bike":
+		return Bike, nil
+	case "shoes":
+		return Shoes, nil
+	default:
+		return Bike, fmt.Errorf("invalid gear kind: %s", s)
+	}
+}
+
+// Sport returns the sport a kind of gear is used for.
+func (k GearKind) Sport() Sport {
+	util.Assert(k >= Bike && k <= Shoes, "invalid gear kind")
+	return []Sport{Cycling, Running}[k]
+}
+
+// DefaultShoesMaxDistance is the mileage in meters after which shoes are
+// flagged for retirement, unless configured otherwise.
+const DefaultShoesMaxDistance = 800000
+
+type Gear struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`
+	IsDefault   bool   `json:"is_default"`
+	MaxDistance int    `json:"max_distance,omitempty"`
+	Retired     bool   `json:"retired,omitempty"`
+	Distance    int    `json:"distance"`
+}
+
+func (g *Gear) OutputTo(w io.Writer) {
+	util.Assert(g != nil, "OutputTo nil gear")
+
+	fmt.Fprintf(w, "ID: %d\nName: %s\nKind: %s\nDistance: %s\n", g.ID, g.Name, g.Kind, util.FormatDistance(g.Distance))
+	if g.MaxDistance > 0 {
+		fmt.Fprintf(w, "Max Distance: %s\n", util.FormatDistance(g.MaxDistance))
+	}
+	if g.IsDefault {
+		fmt.Fprintf(w, "Default: yes\n")
+	}
+	if g.Retired {
+		fmt.Fprintf(w, "Retired: yes\n")
+	}
+}
+
+// Worn reports whether the gear has reached its configured maximum distance.
+func (g *Gear) Worn() bool {
+	return !g.Retired && g.MaxDistance > 0 && g.Distance >= g.MaxDistance
+}
+
+func InsertGear(db *sql.DB, athleteID int64, name string, kind GearKind, maxDistance int, isDefault bool) (int64, error) {
+	util.Assert(db != nil, "InsertGear nil db")
+
+	if strings.TrimSpace(name) == "" {
+		return 0, fmt.Errorf("gear name must not be empty")
+	}
+
+	if maxDistance < 0 {
+		return 0, fmt.Errorf("max distance must be non-negative")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// the first active item of its kind becomes the default
+	var active int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM gear WHERE athlete_id = ? AND kind = ? AND NOT retired`, athleteID, kind.String()).Scan(&active)
+	if err != nil {
+		return 0, err
+	}
+
+	if isDefault || active == 0 {
+		isDefault = true
+		_, err = tx.Exec(`UPDATE gear SET is_default = FALSE WHERE athlete_id = ? AND kind = ?`, athleteID, kind.String())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := tx.Exec(`INSERT INTO gear (athlete_id, name, kind, is_default, max_distance) VALUES (?, ?, ?, ?, ?)`,
+		athleteID, name, kind.String(), isDefault, nullInt(maxDistance))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func RetireGear(db *sql.DB, athleteID int64, id int64) error {
+	util.Assert(db != nil, "RetireGear nil db")
+
+	result, err := db.Exec(`UPDATE gear SET retired = TRUE, is_default = FALSE WHERE id = ? AND athlete_id = ?`, id, athleteID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("no gear with id %d", id)
+	}
+
+	return nil
+}
+
+const gearQuery = `
+	SELECT gear.id, gear.name, gear.kind, gear.is_default, gear.max_distance, gear.retired,
+		COALESCE((SELECT SUM(distance) FROM activities WHERE activities.gear_id = gear.id AND activities.deleted_at IS NULL), 0)
+	FROM gear`
+
+func scanGear(row scanner) (Gear, error) {
+	var gear Gear
+	var maxDistance sql.NullInt64
+
+	err := row.Scan(&gear.ID, &gear.Name, &gear.Kind, &gear.IsDefault, &maxDistance, &gear.Retired, &gear.Distance)
+	gear.MaxDistance = int(maxDistance.Int64)
+
+	return gear, err
+}
+
+// AllGear returns the registered gear, active items first.
+func AllGear(db *sql.DB, athleteID int64, includeRetired bool) ([]Gear, error) {
+	util.Assert(db != nil, "AllGear nil db")
+
+	query := gearQuery + ` WHERE gear.athlete_id = ?`
+	if !includeRetired {
+		query += ` AND NOT gear.retired`
+	}
+	query += ` ORDER BY gear.retired, gear.kind, gear.id`
+
+	rows, err := db.Query(query, athleteID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying gear: %v", err)
+	}
+	defer rows.Close()
+
+	gear := []Gear{}
+	for rows.Next() {
+		item, err := scanGear(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning gear: %v", err)
+		}
+		gear = append(gear, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating gear: %v", err)
+	}
+
+	return gear, nil
+}
+
+func GearByID(db *sql.DB, athleteID int64, id int64) (Gear, error) {
+	util.Assert(db != nil, "GearByID nil db")
+
+	return gearByID(db, athleteID, id)
+}
+
+func gearByID(q querier, athleteID int64, id int64) (Gear, error) {
+	gear, err := scanGear(q.QueryRow(gearQuery+` WHERE gear.id = ? AND gear.athlete_id = ?`, id, athleteID))
+	if err == sql.ErrNoRows {
+		return gear, fmt.Errorf("no gear with id %d", id)
+	}
+	if err != nil {
+		return gear, fmt.Errorf("error reading gear %d: %v", id, err)
+	}
+
+	return gear, nil
+}
+
+func gearKindOfSport(sport Sport) (GearKind, bool) {
+	for _, kind := range []GearKind{Bike, Shoes} {
+		if kind.Sport() == sport {
+			return kind, true
+		}
+	}
+	return Bike, false
+}
+
+// DefaultGearID returns the default gear for a sport, or 0 if there is none.
+func DefaultGearID(db *sql.DB, athleteID int64, sport Sport) (int64, error) {
+	kind, found := gearKindOfSport(sport)
+	if !found {
+		return 0, nil
+	}
+
+	var id int64
+	err := db.QueryRow(`SELECT id FROM gear WHERE athlete_id = ? AND kind = ? AND is_default AND NOT retired`, athleteID, kind.String()).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return id, err
+}
+
+// checkGear verifies that the gear of an activity exists, belongs to the
+// athlete and suits the sport. Retired gear is only accepted with
+// allowRetired, i.e., when the user asked for it or the activity already had
+// it.
+func checkGear(q querier, athleteID int64, activity activity, allowRetired bool) error {
+	if activity.a.GearID == 0 {
+		return nil
+	}
+
+	gear, err := gearByID(q, athleteID, activity.a.GearID)
+	if err != nil {
+		return err
+	}
+
+	if gear.Retired && !allowRetired {
+		return fmt.Errorf("gear %d (%s) is retired", gear.ID, gear.Name)
+	}
+
+	kind, err := GearKindFromString(gear.Kind)
+	if err != nil {
+		return err
+	}
+
+	if kind.Sport() != activity.sport {
+		return fmt.Errorf("gear %d (%s) cannot be used for %s", gear.ID, gear.Name, activity.sport)
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/vasilisp/velora/internal/util"
+)
+
+// Lap is a split of an activity, such as an auto-lap kilometer or a manual
+// lap. Laps are stored in order, so their index is their position.
+type Lap struct {
+	Distance     int `json:"distance" jsonschema_description:"The distance of the lap in meters"`
+	Duration     int `json:"duration" jsonschema_description:"The duration of the lap in seconds"`
+	AvgHeartRate int `json:"avg_heart_rate,omitempty" jsonschema_description:"The average heart rate of the lap in beats per minute, if known"`
+	AvgPower     int `json:"avg_power,omitempty" jsonschema_description:"The average power of the lap in Watts, if known"`
+	VerticalGain int `json:"vertical_gain,omitempty" jsonschema_description:"The vertical gain of the lap in meters, if known"`
+}
+
+// Pace returns the pace of the lap in seconds per kilometer, or 0 if the lap
+// has no distance.
+func (l Lap) Pace() int {
+	if l.Distance <= 0 {
+		return 0
+	}
+	return l.Duration * 1000 / l.Distance
+}
+
+func (l Lap) validate(info SportInfo) error {
+	if l.Distance < 0 || l.Duration <= 0 || l.AvgHeartRate < 0 || l.AvgPower < 0 || l.VerticalGain < 0 {
+		return fmt.Errorf("laps need a positive duration and non-negative values")
+	}
+
+	if l.AvgHeartRate > 0 && !info.Has(MetricHeartRate) {
+		return fmt.Errorf("heart rate is not tracked for %s", info.Name)
+	}
+
+	if l.AvgPower > 0 && !info.Has(MetricPower) {
+		return fmt.Errorf("power is not tracked for %s", info.Name)
+	}
+
+	if l.VerticalGain > 0 && !info.Has(MetricVerticalGain) {
+		return fmt.Errorf("vertical gain is not tracked for %s", info.Name)
+	}
+
+	return nil
+}
+
+// lapsTolerance is how much the laps may add up to beyond the totals of the
+// activity, since devices round each lap separately.
+const lapsTolerance = 1.05
+
+func validateLaps(a *ActivityUnsafe, info SportInfo) error {
+	distance, duration := 0, 0
+	for _, lap := range a.Laps {
+		if err := lap.validate(info); err != nil {
+			return err
+		}
+		distance += lap.Distance
+		duration += lap.Duration
+	}
+
+	if a.Distance > 0 && float64(distance) > float64(a.Distance)*lapsTolerance {
+		return fmt.Errorf("laps add up to %dm, more than the activity distance of %dm", distance, a.Distance)
+	}
+
+	if float64(duration) > float64(max(a.Duration, a.DurationTotal))*lapsTolerance {
+		return fmt.Errorf("laps add up to %ds, more than the activity duration of %ds", duration, max(a.Duration, a.DurationTotal))
+	}
+
+	return nil
+}
+
+// replaceLaps stores the laps of an activity, replacing any existing ones.
+func replaceLaps(tx *sql.Tx, activityID int64, laps []Lap) error {
+	if _, err := tx.Exec(`DELETE FROM laps WHERE activity_id = ?`, activityID); err != nil {
+		return fmt.Errorf("error deleting laps: %v", err)
+	}
+
+	for i, lap := range laps {
+		_, err := tx.Exec(`INSERT INTO laps (activity_id, lap_index, distance, duration, avg_heart_rate, avg_power, vertical_gain)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			activityID, i, lap.Distance, lap.Duration, nullInt(lap.AvgHeartRate), nullInt(lap.AvgPower), nullInt(lap.VerticalGain))
+		if err != nil {
+			return fmt.Errorf("error inserting lap %d: %v", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+const lapColumns = `laps.activity_id, laps.distance, laps.duration, laps.avg_heart_rate, laps.avg_power, laps.vertical_gain`
+
+func scanLap(row scanner) (int64, Lap, error) {
+	var activityID int64
+	var lap Lap
+	var avgHeartRate, avgPower, verticalGain sql.NullInt64
+
+	if err := row.Scan(&activityID, &lap.Distance, &lap.Duration, &avgHeartRate, &avgPower, &verticalGain); err != nil {
+		return 0, lap, fmt.Errorf("error scanning lap: %v", err)
+	}
+
+	lap.AvgHeartRate = int(avgHeartRate.Int64)
+	lap.AvgPower = int(avgPower.Int64)
+	lap.VerticalGain = int(verticalGain.Int64)
+
+	return activityID, lap, nil
+}
+
+// queryLaps groups the laps returned by a query over lapColumns by activity,
+// keeping their order.
+func queryLaps(q querier, query string, args ...any) (map[int64][]Lap, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying laps: %v", err)
+	}
+	defer rows.Close()
+
+	laps := map[int64][]Lap{}
+	for rows.Next() {
+		activityID, lap, err := scanLap(rows)
+		if err != nil {
+			return nil, err
+		}
+		laps[activityID] = append(laps[activityID], lap)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating laps: %v", err)
+	}
+
+	return laps, nil
+}
+
+func lapsOf(q querier, activityID int64) ([]Lap, error) {
+	laps, err := queryLaps(q, `SELECT `+lapColumns+` FROM laps WHERE activity_id = ? ORDER BY lap_index`, activityID)
+	if err != nil {
+		return nil, err
+	}
+	return laps[activityID], nil
+}
+
+// LapsSince returns the laps of the athlete's activities since the given
+// time, by activity id.
+func LapsSince(db *sql.DB, athleteID int64, since time.Time) (map[int64][]Lap, error) {
+	return queryLaps(db, `SELECT `+lapColumns+` FROM laps
+		JOIN activities ON activities.id = laps.activity_id
+		WHERE activities.athlete_id = ? AND activities.timestamp >= ? AND activities.deleted_at IS NULL
+		ORDER BY laps.activity_id, laps.lap_index`,
+		athleteID, since.Unix())
+}
+
+func formatPaceOf(lap Lap) string {
+	if lap.Distance <= 0 {
+		return ""
+	}
+	return " (" + formatPace(lap.Pace()) + ")"
+}
+
+func outputLapsTo(w io.Writer, laps []Lap) {
+	if len(laps) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "Laps:")
+	for i, lap := range laps {
+		parts := []string{}
+		if lap.AvgHeartRate > 0 {
+			parts = append(parts, fmt.Sprintf("%dbpm", lap.AvgHeartRate))
+		}
+		if lap.AvgPower > 0 {
+			parts = append(parts, fmt.Sprintf("%dW", lap.AvgPower))
+		}
+		if lap.VerticalGain > 0 {
+			parts = append(parts, fmt.Sprintf("+%dm", lap.VerticalGain))
+		}
+
+		details := ""
+		if len(parts) > 0 {
+			details = ", " + strings.Join(parts, ", ")
+		}
+
+		fmt.Fprintf(w, "  %2d. %s in %s%s%s\n", i+1, util.FormatDistance(lap.Distance), util.FormatShortDuration(lap.Duration), formatPaceOf(lap), details)
+	}
+}
@@ -0,0 +1,280 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+)
+
+type migration struct {
+	description string
+	up          func(tx *sql.Tx) error
+}
+
+func execMigration(statements ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// migrations are applied in order; the schema version of a database is the
+// number of migrations applied to it, stored in PRAGMA user_version. Never
+// edit or reorder existing entries, only append new ones.
+var migrations = []migration{
+	{
+		description: "create activities table",
+		up: execMigration(`CREATE TABLE IF NOT EXISTS activities (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			timestamp DATETIME NOT NULL CHECK(timestamp = CAST(timestamp AS INTEGER)),
+			duration INTEGER NOT NULL,
+			duration_total INTEGER NOT NULL,
+			sport TEXT CHECK (sport IN ('running', 'cycling', 'swimming')) NOT NULL,
+			distance INTEGER NOT NULL,
+			vertical_gain INTEGER,
+			notes TEXT,
+			was_recommended BOOLEAN NOT NULL DEFAULT FALSE,
+			segments TEXT
+		)`),
+	},
+	{
+		description: "add heart rate columns",
+		up: execMigration(
+			`ALTER TABLE activities ADD COLUMN avg_heart_rate INTEGER`,
+			`ALTER TABLE activities ADD COLUMN max_heart_rate INTEGER`,
+			`ALTER TABLE activities ADD COLUMN time_in_zones TEXT`,
+		),
+	},
+	{
+		description: "add power columns",
+		up: execMigration(
+			`ALTER TABLE activities ADD COLUMN avg_power INTEGER`,
+			`ALTER TABLE activities ADD COLUMN normalized_power INTEGER`,
+			`ALTER TABLE activities ADD COLUMN work INTEGER`,
+			`ALTER TABLE activities ADD COLUMN intensity_factor REAL`,
+			`ALTER TABLE activities ADD COLUMN tss REAL`,
+		),
+	},
+	{
+		description: "add RPE column and wellness table",
+		up: execMigration(
+			`ALTER TABLE activities ADD COLUMN rpe INTEGER CHECK (rpe BETWEEN 1 AND 10)`,
+			`CREATE TABLE wellness (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				date TEXT NOT NULL UNIQUE,
+				sleep_hours REAL,
+				soreness INTEGER CHECK (soreness BETWEEN 1 AND 10),
+				mood INTEGER CHECK (mood BETWEEN 1 AND 10),
+				resting_hr INTEGER,
+				notes TEXT
+			)`,
+		),
+	},
+	{
+		description: "add gear table",
+		up: execMigration(
+			`CREATE TABLE gear (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				kind TEXT CHECK (kind IN ('bike', 'shoes')) NOT NULL,
+				is_default BOOLEAN NOT NULL DEFAULT FALSE,
+				max_distance INTEGER,
+				retired BOOLEAN NOT NULL DEFAULT FALSE
+			)`,
+			`ALTER TABLE activities ADD COLUMN gear_id INTEGER REFERENCES gear(id)`,
+		),
+	},
+	{
+		description: "add terrain and environment columns",
+		up: execMigration(
+			`ALTER TABLE activities ADD COLUMN surface TEXT CHECK (surface IN ('road', 'gravel', 'trail', 'track'))`,
+			`ALTER TABLE activities ADD COLUMN indoor BOOLEAN NOT NULL DEFAULT FALSE`,
+			`ALTER TABLE activities ADD COLUMN urban BOOLEAN NOT NULL DEFAULT FALSE`,
+			`ALTER TABLE activities ADD COLUMN wind_speed INTEGER`,
+			`ALTER TABLE activities ADD COLUMN temperature INTEGER`,
+		),
+	},
+	{
+		description: "add full-text index over notes",
+		up:          createNotesIndex,
+	},
+	{
+		description: "scope activities, gear and wellness per athlete",
+		up: execMigration(
+			`CREATE TABLE athletes (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE
+			)`,
+			`INSERT INTO athletes (id, name) VALUES (1, 'default')`,
+			`ALTER TABLE activities ADD COLUMN athlete_id INTEGER NOT NULL DEFAULT 1 REFERENCES athletes(id)`,
+			`CREATE INDEX activities_athlete_timestamp ON activities (athlete_id, timestamp)`,
+			`ALTER TABLE gear ADD COLUMN athlete_id INTEGER NOT NULL DEFAULT 1 REFERENCES athletes(id)`,
+			// wellness dates become unique per athlete, which needs a new table
+			`CREATE TABLE wellness_scoped (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				athlete_id INTEGER NOT NULL REFERENCES athletes(id),
+				date TEXT NOT NULL,
+				sleep_hours REAL,
+				soreness INTEGER CHECK (soreness BETWEEN 1 AND 10),
+				mood INTEGER CHECK (mood BETWEEN 1 AND 10),
+				resting_hr INTEGER,
+				notes TEXT,
+				UNIQUE (athlete_id, date)
+			)`,
+			`INSERT INTO wellness_scoped (id, athlete_id, date, sleep_hours, soreness, mood, resting_hr, notes)
+				SELECT id, 1, date, sleep_hours, soreness, mood, resting_hr, notes FROM wellness`,
+			`DROP TABLE wellness`,
+			`ALTER TABLE wellness_scoped RENAME TO wellness`,
+		),
+	},
+	{
+		description: "move the list of sports into a table",
+		up:          createSportRegistry,
+	},
+	{
+		description: "add laps table",
+		up: execMigration(
+			`CREATE TABLE laps (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				activity_id INTEGER NOT NULL REFERENCES activities(id),
+				lap_index INTEGER NOT NULL,
+				distance INTEGER NOT NULL,
+				duration INTEGER NOT NULL,
+				avg_heart_rate INTEGER,
+				avg_power INTEGER,
+				vertical_gain INTEGER,
+				UNIQUE (activity_id, lap_index)
+			)`,
+			`CREATE TRIGGER activities_laps_after_delete AFTER DELETE ON activities BEGIN
+				DELETE FROM laps WHERE activity_id = old.id;
+			END`,
+		),
+	},
+	{
+		description: "add tracks table",
+		up: execMigration(
+			`CREATE TABLE tracks (
+				activity_id INTEGER PRIMARY KEY REFERENCES activities(id),
+				data BLOB NOT NULL
+			)`,
+			`CREATE TRIGGER activities_tracks_after_delete AFTER DELETE ON activities BEGIN
+				DELETE FROM tracks WHERE activity_id = old.id;
+			END`,
+		),
+	},
+	{
+		description: "add soft delete and audit log",
+		up: execMigration(
+			`ALTER TABLE activities ADD COLUMN deleted_at INTEGER`,
+			// audit records outlive the activities they describe, so no
+			// foreign key on activity_id
+			`CREATE TABLE activity_audit (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				athlete_id INTEGER NOT NULL REFERENCES athletes(id),
+				activity_id INTEGER NOT NULL,
+				timestamp INTEGER NOT NULL,
+				source TEXT NOT NULL,
+				action TEXT CHECK (action IN ('insert', 'update', 'delete', 'restore', 'purge')) NOT NULL,
+				old_value TEXT,
+				new_value TEXT
+			)`,
+			`CREATE INDEX activity_audit_activity ON activity_audit (athlete_id, activity_id)`,
+		),
+	},
+	{
+		description: "add load factors to sports",
+		up: execMigration(
+			`ALTER TABLE sports ADD COLUMN load TEXT NOT NULL DEFAULT '{}'`,
+			`UPDATE sports SET load = '{"climb":10,"wind":0.005}' WHERE name = 'running'`,
+			`UPDATE sports SET load = '{"climb":10,"wind":0.01,"urban":0.1}' WHERE name = 'cycling'`,
+		),
+	},
+}
+
+func schemaVersion(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("error reading schema version: %v", err)
+	}
+	return version, nil
+}
+
+func backupFile(path string, version int) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	backupPath := fmt.Sprintf("%s.v%d.bak", path, version)
+	dst, err := os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", err
+	}
+
+	return backupPath, dst.Close()
+}
+
+func applyMigration(db *sql.DB, version int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := migrations[version].up(tx); err != nil {
+		return err
+	}
+
+	// PRAGMA does not accept placeholders; version is an int we control
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// migrate brings the database at path up to the latest schema version. The
+// file is backed up before the first migration is applied, and databases
+// created by a newer binary are rejected.
+func migrate(db *sql.DB, path string) error {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	latest := len(migrations)
+	if version > latest {
+		return fmt.Errorf("database schema version %d is newer than supported version %d; please upgrade velora", version, latest)
+	}
+
+	if version == latest {
+		return nil
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Size() > 0 {
+		backupPath, err := backupFile(path, version)
+		if err != nil {
+			return fmt.Errorf("error backing up database before migration: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "migrating database from version %d to %d (backup at %s)\n", version, latest, backupPath)
+	}
+
+	for ; version < latest; version++ {
+		if err := applyMigration(db, version); err != nil {
+			return fmt.Errorf("error applying migration %d (%s): %v", version+1, migrations[version].description, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vasilisp/velora/internal/util"
+)
+
+// ActivityFilter restricts activity queries; zero fields do not filter.
+type ActivityFilter struct {
+	AthleteID      int64
+	Sports         []string
+	Since          time.Time
+	Until          time.Time
+	MinDistance    int
+	MaxDistance    int
+	WasRecommended *bool
+	// Text is a full-text query over notes, supporting phrases ("windy ride")
+	// and prefixes (knee*)
+	Text string
+	// Trashed selects the activities in the trash instead of the live ones
+	Trashed bool
+	Limit   int
+	Offset  int
+}
+
+// where returns the SQL condition for the filter and its arguments.
+func (f ActivityFilter) where() (string, []any) {
+	conditions := []string{"deleted_at IS NULL"}
+	args := []any{}
+
+	if f.Trashed {
+		conditions = []string{"deleted_at IS NOT NULL"}
+	}
+
+	if f.AthleteID != 0 {
+		conditions = append(conditions, "athlete_id = ?")
+		args = append(args, f.AthleteID)
+	}
+
+	if len(f.Sports) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(f.Sports)), ", ")
+		conditions = append(conditions, "sport IN ("+placeholders+")")
+		for _, sport := range f.Sports {
+			args = append(args, sport)
+		}
+	}
+
+	if !f.Since.IsZero() {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, f.Since.Unix())
+	}
+
+	if !f.Until.IsZero() {
+		conditions = append(conditions, "timestamp < ?")
+		args = append(args, f.Until.Unix())
+	}
+
+	if f.MinDistance > 0 {
+		conditions = append(conditions, "distance >= ?")
+		args = append(args, f.MinDistance)
+	}
+
+	if f.MaxDistance > 0 {
+		conditions = append(conditions, "distance <= ?")
+		args = append(args, f.MaxDistance)
+	}
+
+	if f.WasRecommended != nil {
+		conditions = append(conditions, "was_recommended = ?")
+		args = append(args, *f.WasRecommended)
+	}
+
+	if f.Text != "" {
+		conditions = append(conditions, "id IN (SELECT rowid FROM activities_fts WHERE activities_fts MATCH ?)")
+		args = append(args, f.Text)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// QueryActivities returns the activities matching the filter, most recent
+// first.
+func QueryActivities(db *sql.DB, filter ActivityFilter) ([]ActivityUnsafe, error) {
+	util.Assert(db != nil, "QueryActivities nil db")
+	util.Assert(filter.Limit >= 0 && filter.Offset >= 0, "QueryActivities negative limit or offset")
+
+	if filter.Text != "" {
+		if err := ensureNotesIndex(db); err != nil {
+			return nil, err
+		}
+	}
+
+	where, args := filter.where()
+
+	// SQLite treats a negative limit as no limit
+	limit := filter.Limit
+	if limit == 0 {
+		limit = -1
+	}
+	args = append(args, limit, filter.Offset)
+
+	rows, err := db.Query(`
+		SELECT `+activityColumns+`
+		FROM activities
+		WHERE `+where+`
+		ORDER BY timestamp DESC, id DESC
+		LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		if err := searchError(filter.Text, err); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error querying activities: %v", err)
+	}
+	defer rows.Close()
+
+	activities := []ActivityUnsafe{}
+	for rows.Next() {
+		activity, err := scanActivity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning activity: %v", err)
+		}
+		activities = append(activities, activity)
+	}
+
+	if err := rows.Err(); err != nil {
+		if err := searchError(filter.Text, err); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error iterating activities: %v", err)
+	}
+
+	return activities, nil
+}
@@ -0,0 +1,228 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/vasilisp/velora/internal/util"
+)
+
+// SegmentKinds lists the roles a step can have in a workout; an empty kind
+// means a work step.
+var SegmentKinds = []string{"warmup", "work", "recovery", "cooldown"}
+
+// Step is a single part of a workout, such as an interval or the recovery
+// after it. Every target is optional.
+type Step struct {
+	Kind      string `json:"kind,omitempty" jsonschema:"enum=warmup,enum=work,enum=recovery,enum=cooldown" jsonschema_description:"The role of the step (warmup, work, recovery, or cooldown); defaults to work"`
+	Distance  int    `json:"distance,omitempty" jsonschema_description:"The distance of the step in meters; set either the distance or the duration"`
+	Duration  int    `json:"duration,omitempty" jsonschema_description:"The duration of the step in seconds; set either the distance or the duration"`
+	Zone      int    `json:"zone,omitempty" jsonschema_description:"The target intensity zone, starting from 1"`
+	Power     int    `json:"power,omitempty" jsonschema_description:"The target power in Watts"`
+	Pace      int    `json:"pace,omitempty" jsonschema_description:"The target pace in seconds per kilometer"`
+	HeartRate int    `json:"heart_rate,omitempty" jsonschema_description:"The target heart rate in beats per minute"`
+}
+
+// Block is a step of a segment. Like a segment, it is a single step, or, if
+// Steps is not empty, a block of steps, repeated Repeat times; this gives
+// sets such as 3x(4x(400m, 200m jog), 3min rest). Blocks do not nest
+// further, since the schemas given to the model cannot be recursive. Blocks
+// stored before they could repeat decode as single steps done once.
+type Block struct {
+	Repeat int `json:"repeat,omitempty" jsonschema_description:"The number of times to repeat the step or block; leave unset to do it once"`
+	Step
+	Steps []Step `json:"steps,omitempty" jsonschema_description:"The steps of a repeated block, in order; leave empty for a single step, whose fields are then set on the block itself"`
+}
+
+// Segment is a step repeated Repeat times, or, if Steps is not empty, a block
+// of steps repeated Repeat times, such as 6x(3min at 300W, 2min easy).
+// Segments stored before steps existed only carry repeat, distance and zone,
+// and decode as single steps.
+type Segment struct {
+	Repeat int `json:"repeat" jsonschema_description:"The number of times to repeat the segment. Can be 1."`
+	Step
+	Steps []Block `json:"steps,omitempty" jsonschema_description:"The steps of a repeated block, in order; leave empty for a single step, whose fields are then set on the segment itself. Steps can themselves be repeated blocks of steps"`
+}
+
+func (s Step) isEmpty() bool {
+	return s == Step{}
+}
+
+func (s Step) validate(info SportInfo) error {
+	if s.Kind != "" && !slices.Contains(SegmentKinds, s.Kind) {
+		return fmt.Errorf("invalid segment kind: %s", s.Kind)
+	}
+
+	if s.Distance < 0 || s.Duration < 0 || s.Zone < 0 || s.Power < 0 || s.Pace < 0 || s.HeartRate < 0 {
+		return fmt.Errorf("segment values must be non-negative")
+	}
+
+	if s.Distance == 0 && s.Duration == 0 {
+		return fmt.Errorf("segment steps need a distance or a duration")
+	}
+
+	if s.Zone > len(info.Zones) {
+		return fmt.Errorf("segment zone must be between 1 and %d for %s", len(info.Zones), info.Name)
+	}
+
+	if s.Power > 0 && !info.Has(MetricPower) {
+		return fmt.Errorf("power targets are not supported for %s", info.Name)
+	}
+
+	if s.HeartRate > 0 && !info.Has(MetricHeartRate) {
+		return fmt.Errorf("heart rate targets are not supported for %s", info.Name)
+	}
+
+	return nil
+}
+
+func (b Block) validate(info SportInfo) error {
+	if b.Repeat < 0 {
+		return fmt.Errorf("segment repeat must be non-negative")
+	}
+
+	if len(b.Steps) == 0 {
+		return b.Step.validate(info)
+	}
+
+	if !b.Step.isEmpty() {
+		return fmt.Errorf("a block with steps cannot have its own distance, duration or targets")
+	}
+
+	for _, step := range b.Steps {
+		if err := step.validate(info); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s Segment) validate(info SportInfo) error {
+	if s.Repeat < 0 {
+		return fmt.Errorf("segment repeat must be non-negative")
+	}
+
+	if len(s.Steps) == 0 {
+		return s.Step.validate(info)
+	}
+
+	if !s.Step.isEmpty() {
+		return fmt.Errorf("a segment with steps cannot have its own distance, duration or targets")
+	}
+
+	for _, block := range s.Steps {
+		if err := block.validate(info); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func formatPace(secondsPerKm int) string {
+	return fmt.Sprintf("%d:%02d/km", secondsPerKm/60, secondsPerKm%60)
+}
+
+// String describes the step in one line, e.g. "3m at 300W, zone 4".
+func (s Step) String() string {
+	parts := []string{}
+	if s.Kind != "" && s.Kind != "work" {
+		parts = append(parts, s.Kind)
+	}
+	if s.Distance > 0 {
+		parts = append(parts, util.FormatDistance(s.Distance))
+	}
+	if s.Duration > 0 {
+		parts = append(parts, util.FormatShortDuration(s.Duration))
+	}
+
+	targets := []string{}
+	if s.Power > 0 {
+		targets = append(targets, fmt.Sprintf("%dW", s.Power))
+	}
+	if s.Pace > 0 {
+		targets = append(targets, formatPace(s.Pace))
+	}
+	if s.HeartRate > 0 {
+		targets = append(targets, fmt.Sprintf("%dbpm", s.HeartRate))
+	}
+	if s.Zone > 0 {
+		targets = append(targets, fmt.Sprintf("zone %d", s.Zone))
+	}
+
+	description := strings.Join(parts, " ")
+	if len(targets) > 0 {
+		description += " at " + strings.Join(targets, ", ")
+	}
+
+	return description
+}
+
+func formatRepeat(repeat int) string {
+	if repeat > 1 {
+		return fmt.Sprintf("%dx ", repeat)
+	}
+	return ""
+}
+
+// String describes the block in one line, e.g. "4x (400m, recovery 200m)".
+func (b Block) String() string {
+	if len(b.Steps) == 0 {
+		return formatRepeat(b.Repeat) + b.Step.String()
+	}
+
+	steps := make([]string, len(b.Steps))
+	for i, step := range b.Steps {
+		steps[i] = step.String()
+	}
+
+	return fmt.Sprintf("%s(%s)", formatRepeat(b.Repeat), strings.Join(steps, ", "))
+}
+
+// String describes the segment in one line, e.g. "6x (3m at 300W, recovery
+// 2m at zone 1)".
+func (s Segment) String() string {
+	if len(s.Steps) == 0 {
+		return formatRepeat(s.Repeat) + s.Step.String()
+	}
+
+	steps := make([]string, len(s.Steps))
+	for i, block := range s.Steps {
+		steps[i] = block.String()
+	}
+
+	return fmt.Sprintf("%s(%s)", formatRepeat(s.Repeat), strings.Join(steps, ", "))
+}
+
+// hasSets tells whether some step of the segment is itself a block of steps.
+func (s Segment) hasSets() bool {
+	return slices.ContainsFunc(s.Steps, func(b Block) bool { return len(b.Steps) > 0 })
+}
+
+// OutputSegmentsTo writes one line per segment, indented by prefix. Segments
+// made of sets of blocks get one more line per block.
+func OutputSegmentsTo(w io.Writer, prefix string, segments []Segment) {
+	if len(segments) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "%sSegments:\n", prefix)
+	for _, segment := range segments {
+		if !segment.hasSets() {
+			fmt.Fprintf(w, "%s  - %s\n", prefix, segment)
+			continue
+		}
+
+		sets := "1 set"
+		if segment.Repeat > 1 {
+			sets = fmt.Sprintf("%d sets", segment.Repeat)
+		}
+		fmt.Fprintf(w, "%s  - %s of:\n", prefix, sets)
+		for _, block := range segment.Steps {
+			fmt.Fprintf(w, "%s    - %s\n", prefix, block)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+	"github.com/vasilisp/velora/internal/util"
+)
+
+// Measure is how the volume of a sport is tracked.
+type Measure uint
+
+const (
+	ByDistance Measure = iota
+	ByDuration
+)
+
+func (m Measure) String() string {
+	util.Assert(m >= ByDistance && m <= ByDuration, "invalid measure")
+	return []string{"distance", "duration"}[m]
+}
+
+func MeasureFromString(s string) (Measure, error) {
+	switch strings.ToLower(s) {
+	case "distance":
+		return ByDistance, nil
+	case "duration":
+		return ByDuration, nil
+	default:
+		return ByDistance, fmt.Errorf("invalid measure: %s", s)
+	}
+}
+
+func (m Measure) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Measure) UnmarshalText(text []byte) error {
+	measure, err := MeasureFromString(string(text))
+	if err != nil {
+		return err
+	}
+
+	*m = measure
+	return nil
+}
+
+// metrics an activity may record besides its duration and distance
+const (
+	MetricVerticalGain = "vertical_gain"
+	MetricHeartRate    = "heart_rate"
+	MetricPower        = "power"
+	MetricSurface      = "surface"
+)
+
+var Metrics = []string{MetricVerticalGain, MetricHeartRate, MetricPower, MetricSurface}
+
+// DefaultZones describes the intensity zones of sports that do not define
+// their own.
+var DefaultZones = []string{
+	"recovery",
+	"endurance",
+	"tempo",
+	"threshold",
+	"VO2 max",
+}
+
+// LoadFactors describe how conditions make an activity harder than its
+// distance alone suggests. Zero factors have no effect.
+type LoadFactors struct {
+	// Climb is the flat distance in meters equivalent to one meter of
+	// vertical gain
+	Climb float64 `json:"climb,omitempty"`
+	// Wind is the extra effort per km/h of wind above 15 km/h
+	Wind float64 `json:"wind,omitempty"`
+	// Urban is the extra effort of stop-and-go activities in towns
+	Urban float64 `json:"urban,omitempty"`
+}
+
+func (f LoadFactors) validate() error {
+	if f.Climb < 0 || f.Wind < 0 || f.Urban < 0 {
+		return fmt.Errorf("negative load factor")
+	}
+	return nil
+}
+
+// SportInfo describes a sport in the registry.
+type SportInfo struct {
+	Name    string   `json:"name"`
+	Measure Measure  `json:"measure"`
+	Metrics []string `json:"metrics"`
+	// Zones describes the intensity zones used by workout segments, starting
+	// from zone 1
+	Zones []string    `json:"zones"`
+	Load  LoadFactors `json:"load,omitzero"`
+}
+
+func (info SportInfo) Has(metric string) bool {
+	return slices.Contains(info.Metrics, metric)
+}
+
+var sportNameRegexp = regexp.MustCompile(`^[a-z][a-z_]*$`)
+
+func (info SportInfo) validate() error {
+	if !sportNameRegexp.MatchString(info.Name) {
+		return fmt.Errorf("invalid sport name %q: use lowercase letters and '_'", info.Name)
+	}
+
+	for _, metric := range info.Metrics {
+		if !slices.Contains(Metrics, metric) {
+			return fmt.Errorf("invalid metric %q for sport %s; known metrics: %s", metric, info.Name, strings.Join(Metrics, ", "))
+		}
+	}
+
+	if len(info.Zones) == 0 {
+		return fmt.Errorf("sport %s has no zones", info.Name)
+	}
+
+	if err := info.Load.validate(); err != nil {
+		return fmt.Errorf("invalid load factors for sport %s: %v", info.Name, err)
+	}
+
+	return nil
+}
+
+type Sport uint
+
+// the built-in sports, registered by the migrations in this order
+const (
+	Running Sport = iota
+	Cycling
+	Swimming
+)
+
+// registry holds the known sports, indexed by Sport. It starts with the
+// built-in sports and is replaced by the contents of the sports table when a
+// database is opened.
+var registry = []SportInfo{
+	{Name: "running", Measure: ByDistance, Metrics: []string{MetricVerticalGain, MetricHeartRate, MetricPower, MetricSurface}, Zones: DefaultZones, Load: LoadFactors{Climb: 10, Wind: 0.005}},
+	{Name: "cycling", Measure: ByDistance, Metrics: []string{MetricVerticalGain, MetricHeartRate, MetricPower, MetricSurface}, Zones: DefaultZones, Load: LoadFactors{Climb: 10, Wind: 0.01, Urban: 0.1}},
+	{Name: "swimming", Measure: ByDistance, Metrics: []string{MetricHeartRate}, Zones: DefaultZones},
+}
+
+// isBuiltin tells whether name is one of the built-in sports.
+func isBuiltin(name string) bool {
+	for _, sport := range []Sport{Running, Cycling, Swimming} {
+		if sport.String() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Sport) Info() SportInfo {
+	util.Assert(int(s) < len(registry), "invalid sport")
+	return registry[s]
+}
+
+func (s Sport) String() string {
+	return s.Info().Name
+}
+
+func SportFromString(s string) (Sport, error) {
+	name := strings.ToLower(s)
+	for i, info := range registry {
+		if info.Name == name {
+			return Sport(i), nil
+		}
+	}
+
+	return Running, fmt.Errorf("invalid sport: %s", s)
+}
+
+// AllSports lists all the registered sports.
+func AllSports() []Sport {
+	sports := make([]Sport, len(registry))
+	for i := range registry {
+		sports[i] = Sport(i)
+	}
+	return sports
+}
+
+// AllSportInfo lists the descriptions of all the registered sports.
+func AllSportInfo() []SportInfo {
+	return slices.Clone(registry)
+}
+
+func sportNames() []any {
+	names := make([]any, len(registry))
+	for i, info := range registry {
+		names[i] = info.Name
+	}
+	return names
+}
+
+// MarshalText encodes sports by name, both as JSON values and as map keys.
+func (s Sport) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Sport) UnmarshalText(text []byte) error {
+	sport, err := SportFromString(string(text))
+	if err != nil {
+		return err
+	}
+
+	*s = sport
+	return nil
+}
+
+func (Sport) JSONSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{Type: "string", Enum: sportNames(), Description: "The name of the sport"}
+}
+
+// loadSports replaces the registry with the sports stored in the database.
+func loadSports(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name, measure, metrics, zones, load FROM sports ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("error querying sports: %v", err)
+	}
+	defer rows.Close()
+
+	sports := []SportInfo{}
+	for rows.Next() {
+		var info SportInfo
+		var measure string
+		var metrics, zones, load []byte
+
+		if err := rows.Scan(&info.Name, &measure, &metrics, &zones, &load); err != nil {
+			return fmt.Errorf("error scanning sport: %v", err)
+		}
+
+		if info.Measure, err = MeasureFromString(measure); err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(metrics, &info.Metrics); err != nil {
+			return fmt.Errorf("error unmarshalling metrics of %s: %v", info.Name, err)
+		}
+
+		if err := json.Unmarshal(zones, &info.Zones); err != nil {
+			return fmt.Errorf("error unmarshalling zones of %s: %v", info.Name, err)
+		}
+
+		if err := json.Unmarshal(load, &info.Load); err != nil {
+			return fmt.Errorf("error unmarshalling load factors of %s: %v", info.Name, err)
+		}
+
+		sports = append(sports, info)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating sports: %v", err)
+	}
+
+	for i, info := range registry[:Swimming+1] {
+		util.Assert(i < len(sports) && sports[i].Name == info.Name, "built-in sports out of order")
+	}
+
+	registry = sports
+	return nil
+}
+
+// ConfigureSports adds the sports defined in the JSON file at path to the
+// database, or updates them if they already exist, and reloads the registry.
+// Sports are never removed, since activities may refer to them, and built-in
+// sports cannot be redefined. A missing file is not an error.
+func ConfigureSports(db *sql.DB, path string) error {
+	bytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading sports: %v", err)
+	}
+
+	var sports []SportInfo
+	if err := json.Unmarshal(bytes, &sports); err != nil {
+		return fmt.Errorf("error unmarshalling sports %s: %v", path, err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, info := range sports {
+		if isBuiltin(info.Name) {
+			return fmt.Errorf("error in sports %s: %s is built in and cannot be redefined", path, info.Name)
+		}
+
+		if len(info.Zones) == 0 {
+			info.Zones = DefaultZones
+		}
+
+		if info.Metrics == nil {
+			info.Metrics = []string{}
+		}
+
+		if err := info.validate(); err != nil {
+			return fmt.Errorf("error in sports %s: %v", path, err)
+		}
+
+		metrics, err := json.Marshal(info.Metrics)
+		if err != nil {
+			return err
+		}
+
+		zones, err := json.Marshal(info.Zones)
+		if err != nil {
+			return err
+		}
+
+		load, err := json.Marshal(info.Load)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO sports (name, measure, metrics, zones, load) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (name) DO UPDATE SET measure = excluded.measure, metrics = excluded.metrics, zones = excluded.zones, load = excluded.load`,
+			info.Name, info.Measure.String(), string(metrics), string(zones), string(load))
+		if err != nil {
+			return fmt.Errorf("error storing sport %s: %v", info.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return loadSports(db)
+}
+
+// createSportRegistry moves the list of sports from a CHECK constraint on
+// activities into the sports table, so that sports can be added without a
+// schema change. SQLite cannot drop a constraint, so the activities table is
+// rebuilt, along with its index and full-text triggers.
+func createSportRegistry(tx *sql.Tx) error {
+	notesIndex, err := notesIndexExists(tx)
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		`CREATE TABLE sports (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			measure TEXT CHECK (measure IN ('distance', 'duration')) NOT NULL,
+			metrics TEXT NOT NULL,
+			zones TEXT NOT NULL
+		)`,
+		`INSERT INTO sports (id, name, measure, metrics, zones) VALUES
+			(1, 'running', 'distance', '["vertical_gain","heart_rate","power","surface"]', '["recovery","endurance","tempo","threshold","VO2 max"]'),
+			(2, 'cycling', 'distance', '["vertical_gain","heart_rate","power","surface"]', '["recovery","endurance","tempo","threshold","VO2 max"]'),
+			(3, 'swimming', 'distance', '["heart_rate"]', '["recovery","endurance","tempo","threshold","VO2 max"]')`,
+		`CREATE TABLE activities_registry (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			timestamp DATETIME NOT NULL CHECK(timestamp = CAST(timestamp AS INTEGER)),
+			duration INTEGER NOT NULL,
+			duration_total INTEGER NOT NULL,
+			sport TEXT NOT NULL,
+			distance INTEGER NOT NULL,
+			vertical_gain INTEGER,
+			notes TEXT,
+			was_recommended BOOLEAN NOT NULL DEFAULT FALSE,
+			segments TEXT,
+			avg_heart_rate INTEGER,
+			max_heart_rate INTEGER,
+			time_in_zones TEXT,
+			avg_power INTEGER,
+			normalized_power INTEGER,
+			work INTEGER,
+			intensity_factor REAL,
+			tss REAL,
+			rpe INTEGER CHECK (rpe BETWEEN 1 AND 10),
+			gear_id INTEGER REFERENCES gear(id),
+			surface TEXT CHECK (surface IN ('road', 'gravel', 'trail', 'track')),
+			indoor BOOLEAN NOT NULL DEFAULT FALSE,
+			urban BOOLEAN NOT NULL DEFAULT FALSE,
+			wind_speed INTEGER,
+			temperature INTEGER,
+			athlete_id INTEGER NOT NULL DEFAULT 1 REFERENCES athletes(id)
+		)`,
+		`INSERT INTO activities_registry (id, timestamp, duration, duration_total, sport, distance, vertical_gain, notes, was_recommended, segments,
+				avg_heart_rate, max_heart_rate, time_in_zones, avg_power, normalized_power, work, intensity_factor, tss, rpe,
+				gear_id, surface, indoor, urban, wind_speed, temperature, athlete_id)
+			SELECT id, timestamp, duration, duration_total, sport, distance, vertical_gain, notes, was_recommended, segments,
+				avg_heart_rate, max_heart_rate, time_in_zones, avg_power, normalized_power, work, intensity_factor, tss, rpe,
+				gear_id, surface, indoor, urban, wind_speed, temperature, athlete_id
+			FROM activities`,
+		// keep ids of deleted activities from being reused
+		`DELETE FROM sqlite_sequence WHERE name = 'activities_registry'`,
+		`INSERT INTO sqlite_sequence (name, seq) SELECT 'activities_registry', seq FROM sqlite_sequence WHERE name = 'activities'`,
+		`DROP TABLE activities`,
+		`ALTER TABLE activities_registry RENAME TO activities`,
+		`CREATE INDEX activities_athlete_timestamp ON activities (athlete_id, timestamp)`,
+		`CREATE TRIGGER activities_sport_insert BEFORE INSERT ON activities
+			WHEN NOT EXISTS (SELECT 1 FROM sports WHERE name = new.sport) BEGIN
+				SELECT RAISE(ABORT, 'unknown sport');
+			END`,
+		`CREATE TRIGGER activities_sport_update BEFORE UPDATE OF sport ON activities
+			WHEN NOT EXISTS (SELECT 1 FROM sports WHERE name = new.sport) BEGIN
+				SELECT RAISE(ABORT, 'unknown sport');
+			END`,
+	}
+
+	if notesIndex {
+		statements = append(statements, notesIndexTriggers()...)
+	}
+
+	return execMigration(statements...)(tx)
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// storeTrack stores the encoded track of an activity, replacing any existing
+// one. A nil track leaves the stored one in place.
+func storeTrack(tx *sql.Tx, activityID int64, track []byte) error {
+	if track == nil {
+		return nil
+	}
+
+	_, err := tx.Exec(`INSERT INTO tracks (activity_id, data) VALUES (?, ?)
+		ON CONFLICT (activity_id) DO UPDATE SET data = excluded.data`, activityID, track)
+	if err != nil {
+		return fmt.Errorf("error storing track: %v", err)
+	}
+
+	return nil
+}
+
+// TrackOf returns the encoded track of a live activity, or nil if it has none
+// or is in the trash.
+func TrackOf(db *sql.DB, athleteID int64, activityID int64) ([]byte, error) {
+	var track []byte
+	err := db.QueryRow(`SELECT tracks.data FROM tracks
+		JOIN activities ON activities.id = tracks.activity_id
+		WHERE tracks.activity_id = ? AND activities.athlete_id = ? AND activities.deleted_at IS NULL`, activityID, athleteID).Scan(&track)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading track of activity %d: %v", activityID, err)
+	}
+
+	return track, nil
+}
+
+// ActivitiesWithTracks returns the ids of the athlete's activities that have a
+// stored track, oldest first.
+func ActivitiesWithTracks(db *sql.DB, athleteID int64) ([]int64, error) {
+	rows, err := db.Query(`SELECT activities.id FROM activities
+		JOIN tracks ON tracks.activity_id = activities.id
+		WHERE activities.athlete_id = ? AND activities.deleted_at IS NULL
+		ORDER BY activities.timestamp, activities.id`, athleteID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tracks: %v", err)
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning track: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/vasilisp/lingograph/extra"
+	"github.com/vasilisp/velora/internal/util"
+)
+
+type WellnessUnsafe struct {
+	Date       string  `json:"date" jsonschema_description:"The day the entry refers to, in YYYY-MM-DD format"`
+	SleepHours float64 `json:"sleep_hours,omitempty" jsonschema_description:"Hours slept the night before, if known"`
+	Soreness   int     `json:"soreness,omitempty" jsonschema_description:"Muscle soreness on a 1-10 scale (1 = none, 10 = severe), if known"`
+	Mood       int     `json:"mood,omitempty" jsonschema_description:"Mood on a 1-10 scale (1 = very low, 10 = excellent), if known"`
+	RestingHR  int     `json:"resting_hr,omitempty" jsonschema_description:"Resting heart rate in beats per minute, if known"`
+	Notes      string  `json:"notes,omitempty" jsonschema_description:"User-provided notes about how they feel"`
+}
+
+type wellness struct {
+	w    WellnessUnsafe
+	date time.Time
+}
+
+func (w WellnessUnsafe) ToWellness() (wellness, error) {
+	date, err := time.ParseInLocation("2006-01-02", w.Date, time.Local)
+	if err != nil {
+		return wellness{}, fmt.Errorf("invalid date %q: %v", w.Date, err)
+	}
+
+	if w.SleepHours < 0 || w.SleepHours > 24 {
+		err = fmt.Errorf("sleep hours must be between 0 and 24")
+	}
+
+	if w.Soreness < 0 || w.Soreness > 10 {
+		err = fmt.Errorf("soreness must be between 1 and 10")
+	}
+
+	if w.Mood < 0 || w.Mood > 10 {
+		err = fmt.Errorf("mood must be between 1 and 10")
+	}
+
+	if w.RestingHR < 0 {
+		err = fmt.Errorf("resting heart rate must be non-negative")
+	}
+
+	if w.SleepHours == 0 && w.Soreness == 0 && w.Mood == 0 && w.RestingHR == 0 && w.Notes == "" {
+		err = fmt.Errorf("wellness entry is empty")
+	}
+
+	return wellness{w: w, date: date}, err
+}
+
+func (w *WellnessUnsafe) OutputTo(out io.Writer) {
+	util.Assert(w != nil, "OutputTo nil wellness")
+
+	fmt.Fprintf(out, "Date: %s\n", w.Date)
+	if w.SleepHours > 0 {
+		fmt.Fprintf(out, "Sleep: %.1fh\n", w.SleepHours)
+	}
+	if w.Soreness > 0 {
+		fmt.Fprintf(out, "Soreness: %d/10\n", w.Soreness)
+	}
+	if w.Mood > 0 {
+		fmt.Fprintf(out, "Mood: %d/10\n", w.Mood)
+	}
+	if w.RestingHR > 0 {
+		fmt.Fprintf(out, "Resting HR: %dbpm\n", w.RestingHR)
+	}
+	if w.Notes != "" {
+		fmt.Fprintf(out, "Notes: %s\n", extra.SanitizeOutputString(w.Notes, true))
+	}
+}
+
+// UpsertWellness stores the entry for its date. A later entry for the same day
+// adds to the earlier one: the values it leaves out are kept.
+func UpsertWellness(db *sql.DB, athleteID int64, wellness wellness) error {
+	util.Assert(db != nil, "UpsertWellness nil db")
+
+	notes := sql.NullString{String: wellness.w.Notes, Valid: wellness.w.Notes != ""}
+
+	_, err := db.Exec(`INSERT INTO wellness (athlete_id, date, sleep_hours, soreness, mood, resting_hr, notes) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (athlete_id, date) DO UPDATE SET sleep_hours = COALESCE(excluded.sleep_hours, wellness.sleep_hours),
+			soreness = COALESCE(excluded.soreness, wellness.soreness), mood = COALESCE(excluded.mood, wellness.mood),
+			resting_hr = COALESCE(excluded.resting_hr, wellness.resting_hr), notes = COALESCE(excluded.notes, wellness.notes)`,
+		athleteID, wellness.date.Format("2006-01-02"), nullFloat(wellness.w.SleepHours), nullInt(wellness.w.Soreness), nullInt(wellness.w.Mood), nullInt(wellness.w.RestingHR), notes)
+	return err
+}
+
+// WellnessSince returns the wellness entries on or after the given day, most
+// recent first.
+func WellnessSince(db *sql.DB, athleteID int64, since time.Time) ([]WellnessUnsafe, error) {
+	util.Assert(db != nil, "WellnessSince nil db")
+
+	rows, err := db.Query(`
+		SELECT date, sleep_hours, soreness, mood, resting_hr, notes
+		FROM wellness
+		WHERE athlete_id = ? AND date >= ?
+		ORDER BY date DESC`, athleteID, since.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("error querying wellness: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []WellnessUnsafe{}
+	for rows.Next() {
+		var entry WellnessUnsafe
+		var sleepHours sql.NullFloat64
+		var soreness, mood, restingHR sql.NullInt64
+		var notes sql.NullString
+
+		err := rows.Scan(&entry.Date, &sleepHours, &soreness, &mood, &restingHR, &notes)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning wellness: %v", err)
+		}
+
+		entry.SleepHours = sleepHours.Float64
+		entry.Soreness = int(soreness.Int64)
+		entry.Mood = int(mood.Int64)
+		entry.RestingHR = int(restingHR.Int64)
+		entry.Notes = notes.String
+
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating wellness: %v", err)
+	}
+
+	return entries, nil
+}
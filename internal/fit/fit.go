@@ -0,0 +1,278 @@
+// Package fit decodes the FIT files recorded by Garmin, Wahoo and other
+// devices, following the FIT protocol of the Garmin FIT SDK.
+package fit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Global message numbers of the messages velora reads.
+const (
+	MesgFileID  = 0
+	MesgSession = 18
+	MesgLap     = 19
+	MesgRecord  = 20
+)
+
+// FieldTimestamp is the field number of the timestamp in every message that
+// has one.
+const FieldTimestamp = 253
+
+// epoch is the start of FIT time; timestamps are seconds since then.
+var epoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// Time converts a FIT timestamp.
+func Time(timestamp int64) time.Time {
+	return epoch.Add(time.Duration(timestamp) * time.Second).UTC()
+}
+
+// Message is a decoded data message. Only valid integer fields holding a
+// single value are kept; floating point, string and array fields are
+// skipped, since velora uses none of them.
+type Message struct {
+	Num    uint16
+	Fields map[uint8]int64
+}
+
+// Get returns a field of the message and whether it has a valid value.
+func (m Message) Get(field uint8) (int64, bool) {
+	value, found := m.Fields[field]
+	return value, found
+}
+
+type fieldDefinition struct {
+	num      uint8
+	size     int
+	baseType uint8
+}
+
+type definition struct {
+	num    uint16
+	order  binary.ByteOrder
+	fields []fieldDefinition
+	// developer fields are skipped, so only their total size is needed
+	developerSize int
+}
+
+// Decode reads all the data messages of a FIT file, including chained
+// files, checking the CRC of each.
+func Decode(r io.Reader) ([]Message, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading FIT file: %v", err)
+	}
+
+	messages := []Message{}
+	for len(data) > 0 {
+		n, chained, err := decodeFile(data)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, chained...)
+		data = data[n:]
+	}
+
+	return messages, nil
+}
+
+// decodeFile decodes the file at the start of data and returns its length.
+func decodeFile(data []byte) (int, []Message, error) {
+	if len(data) < 12 {
+		return 0, nil, fmt.Errorf("truncated FIT header")
+	}
+
+	headerSize := int(data[0])
+	if headerSize < 12 || len(data) < headerSize || string(data[8:12]) != ".FIT" {
+		return 0, nil, fmt.Errorf("not a FIT file")
+	}
+
+	end := headerSize + int(binary.LittleEndian.Uint32(data[4:8]))
+	if len(data) < end+2 {
+		return 0, nil, fmt.Errorf("truncated FIT file")
+	}
+
+	if crc(data[:end]) != binary.LittleEndian.Uint16(data[end:end+2]) {
+		return 0, nil, fmt.Errorf("FIT file CRC mismatch")
+	}
+
+	d := decoder{data: data[headerSize:end]}
+	messages, err := d.decode()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return end + 2, messages, nil
+}
+
+type decoder struct {
+	data          []byte
+	pos           int
+	definitions   [16]*definition
+	lastTimestamp int64
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if d.pos+n > len(d.data) {
+		return nil, fmt.Errorf("truncated FIT record")
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) decode() ([]Message, error) {
+	messages := []Message{}
+
+	for d.pos < len(d.data) {
+		header, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+
+		switch h := header[0]; {
+		case h&0x80 != 0:
+			// compressed timestamp header: the low 5 bits are the
+			// timestamp, relative to the last full one
+			message, err := d.readData((h >> 5) & 0x03)
+			if err != nil {
+				return nil, err
+			}
+			offset := int64(h & 0x1F)
+			d.lastTimestamp += (offset - d.lastTimestamp) & 0x1F
+			message.Fields[FieldTimestamp] = d.lastTimestamp
+			messages = append(messages, message)
+		case h&0x40 != 0:
+			if err := d.readDefinition(h&0x0F, h&0x20 != 0); err != nil {
+				return nil, err
+			}
+		default:
+			message, err := d.readData(h & 0x0F)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, message)
+		}
+	}
+
+	return messages, nil
+}
+
+func (d *decoder) readDefinition(local uint8, hasDeveloperFields bool) error {
+	header, err := d.read(5)
+	if err != nil {
+		return err
+	}
+
+	def := &definition{order: binary.LittleEndian}
+	if header[1] == 1 {
+		def.order = binary.BigEndian
+	}
+	def.num = def.order.Uint16(header[2:4])
+
+	fields, err := d.read(3 * int(header[4]))
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(fields); i += 3 {
+		def.fields = append(def.fields, fieldDefinition{num: fields[i], size: int(fields[i+1]), baseType: fields[i+2]})
+	}
+
+	if hasDeveloperFields {
+		count, err := d.read(1)
+		if err != nil {
+			return err
+		}
+		developerFields, err := d.read(3 * int(count[0]))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(developerFields); i += 3 {
+			def.developerSize += int(developerFields[i+1])
+		}
+	}
+
+	d.definitions[local] = def
+	return nil
+}
+
+func (d *decoder) readData(local uint8) (Message, error) {
+	def := d.definitions[local]
+	if def == nil {
+		return Message{}, fmt.Errorf("FIT data message without definition")
+	}
+
+	message := Message{Num: def.num, Fields: map[uint8]int64{}}
+	for _, field := range def.fields {
+		b, err := d.read(field.size)
+		if err != nil {
+			return message, err
+		}
+		if value, ok := decodeValue(b, field.baseType, def.order); ok {
+			message.Fields[field.num] = value
+		}
+	}
+
+	if _, err := d.read(def.developerSize); err != nil {
+		return message, err
+	}
+
+	if timestamp, found := message.Fields[FieldTimestamp]; found {
+		d.lastTimestamp = timestamp
+	}
+
+	return message, nil
+}
+
+// baseTypeSizes are the sizes of the FIT base types, by base type number.
+var baseTypeSizes = [17]int{1, 1, 1, 2, 2, 4, 4, 1, 4, 8, 1, 2, 4, 1, 8, 8, 8}
+
+// decodeValue decodes a single integer value, reporting false for invalid
+// values and for the types Message does not keep.
+func decodeValue(b []byte, baseType uint8, order binary.ByteOrder) (int64, bool) {
+	num := baseType & 0x1F
+	if int(num) >= len(baseTypeSizes) || len(b) != baseTypeSizes[num] {
+		return 0, false
+	}
+
+	var value int64
+	var invalid bool
+	switch num {
+	case 0x00, 0x02, 0x0D: // enum, uint8, byte
+		value, invalid = int64(b[0]), b[0] == 0xFF
+	case 0x01: // sint8
+		value, invalid = int64(int8(b[0])), b[0] == 0x7F
+	case 0x0A: // uint8z
+		value, invalid = int64(b[0]), b[0] == 0
+	case 0x03: // sint16
+		v := order.Uint16(b)
+		value, invalid = int64(int16(v)), v == 0x7FFF
+	case 0x04: // uint16
+		v := order.Uint16(b)
+		value, invalid = int64(v), v == 0xFFFF
+	case 0x0B: // uint16z
+		v := order.Uint16(b)
+		value, invalid = int64(v), v == 0
+	case 0x05: // sint32
+		v := order.Uint32(b)
+		value, invalid = int64(int32(v)), v == 0x7FFFFFFF
+	case 0x06: // uint32
+		v := order.Uint32(b)
+		value, invalid = int64(v), v == 0xFFFFFFFF
+	case 0x0C: // uint32z
+		v := order.Uint32(b)
+		value, invalid = int64(v), v == 0
+	case 0x0E: // sint64
+		v := order.Uint64(b)
+		value, invalid = int64(v), v == 0x7FFFFFFFFFFFFFFF
+	case 0x0F, 0x10: // uint64, uint64z
+		v := order.Uint64(b)
+		value, invalid = int64(v), v == 0xFFFFFFFFFFFFFFFF || (num == 0x10 && v == 0) || v > 1<<63-1
+	default: // string, float32, float64
+		return 0, false
+	}
+
+	return value, !invalid
+}
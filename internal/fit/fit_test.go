@@ -0,0 +1,139 @@
+package fit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// file wraps records in a FIT header and CRC.
+func file(records []byte) []byte {
+	header := []byte{14, 0x10, 0, 0, 0, 0, 0, 0, '.', 'F', 'I', 'T', 0, 0}
+	binary.LittleEndian.PutUint32(header[4:8], uint32(len(records)))
+
+	data := append(header, records...)
+	return binary.LittleEndian.AppendUint16(data, crc(data))
+}
+
+// definitions of local message 0, records with a timestamp and a heart rate,
+// and local message 1, records with a heart rate only, as sent with
+// compressed timestamps
+var recordDefinitions = []byte{
+	0x40, 0, 0, MesgRecord, 0, 2, FieldTimestamp, 4, 0x86, 3, 1, 0x02,
+	0x41, 0, 0, MesgRecord, 0, 1, 3, 1, 0x02,
+}
+
+func TestCRC(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want uint16
+	}{
+		{"empty", "", 0},
+		{"check value", "123456789", 0xBB3D},
+		{"single byte", "A", 0x30C0},
+	}
+
+	for _, test := range tests {
+		if got := crc([]byte(test.data)); got != test.want {
+			t.Errorf("%s: crc = %#04x, want %#04x", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDecodeCRCMismatch(t *testing.T) {
+	data := file(recordDefinitions)
+	data[len(data)-1] ^= 0xFF
+
+	if _, err := Decode(bytes.NewReader(data)); err == nil {
+		t.Errorf("Decode accepted a file with a bad CRC")
+	}
+}
+
+func TestCompressedTimestamp(t *testing.T) {
+	tests := []struct {
+		name      string
+		timestamp uint32
+		offset    byte
+		want      int64
+	}{
+		{"same second", 1000, 1000 & 0x1F, 1000},
+		{"forward", 1000, (1000 + 5) & 0x1F, 1005},
+		{"rollover", 1022, 2, 1026},
+		{"rollover from last offset", 1023, 0, 1024},
+		{"full window", 1024, 31, 1055},
+	}
+
+	for _, test := range tests {
+		records := append([]byte{}, recordDefinitions...)
+		records = append(records, 0x00)
+		records = binary.LittleEndian.AppendUint32(records, test.timestamp)
+		records = append(records, 120)
+		records = append(records, 0x80|1<<5|test.offset, 121)
+
+		messages, err := Decode(bytes.NewReader(file(records)))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if len(messages) != 2 {
+			t.Fatalf("%s: got %d messages, want 2", test.name, len(messages))
+		}
+
+		if got, _ := messages[1].Get(FieldTimestamp); got != test.want {
+			t.Errorf("%s: timestamp = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestInvalidValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		baseType uint8
+		data     []byte
+		want     int64
+		valid    bool
+	}{
+		{"enum", 0x00, []byte{0xFF}, 0, false},
+		{"uint8", 0x02, []byte{0xFF}, 0, false},
+		{"uint8 value", 0x02, []byte{0xFE}, 0xFE, true},
+		{"sint8", 0x01, []byte{0x7F}, 0, false},
+		{"sint8 negative", 0x01, []byte{0x80}, -128, true},
+		{"uint8z", 0x0A, []byte{0x00}, 0, false},
+		{"sint16", 0x83, []byte{0xFF, 0x7F}, 0, false},
+		{"uint16", 0x84, []byte{0xFF, 0xFF}, 0, false},
+		{"uint16 value", 0x84, []byte{0x34, 0x12}, 0x1234, true},
+		{"uint16z", 0x8B, []byte{0x00, 0x00}, 0, false},
+		{"sint32", 0x85, []byte{0xFF, 0xFF, 0xFF, 0x7F}, 0, false},
+		{"uint32", 0x86, []byte{0xFF, 0xFF, 0xFF, 0xFF}, 0, false},
+		{"uint32z", 0x8C, []byte{0x00, 0x00, 0x00, 0x00}, 0, false},
+		{"uint64", 0x8F, bytes.Repeat([]byte{0xFF}, 8), 0, false},
+		{"string", 0x07, []byte{'a'}, 0, false},
+		{"wrong size", 0x84, []byte{0x01}, 0, false},
+	}
+
+	for _, test := range tests {
+		got, valid := decodeValue(test.data, test.baseType, binary.LittleEndian)
+		if valid != test.valid || (valid && got != test.want) {
+			t.Errorf("%s: decodeValue = %d, %t, want %d, %t", test.name, got, valid, test.want, test.valid)
+		}
+	}
+}
+
+func TestInvalidFieldsAreAbsent(t *testing.T) {
+	records := append([]byte{}, recordDefinitions...)
+	records = append(records, 0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+
+	messages, err := Decode(bytes.NewReader(file(records)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+
+	for _, field := range []uint8{FieldTimestamp, 3} {
+		if value, found := messages[0].Get(field); found {
+			t.Errorf("field %d = %d, want absent", field, value)
+		}
+	}
+}
@@ -3,9 +3,12 @@ package fitness
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"slices"
 	"time"
 
 	"github.com/invopop/jsonschema"
+	"github.com/vasilisp/velora/internal/config"
 	"github.com/vasilisp/velora/internal/db"
 	"github.com/vasilisp/velora/internal/profile"
 	"github.com/vasilisp/velora/internal/util"
@@ -17,16 +20,34 @@ type Fitness struct {
 	ActivitiesLastWeek []db.ActivityUnsafe `json:"activities_last_week"`
 	ActivitiesOlder    []db.ActivityUnsafe `json:"activities_older"`
 	Skeleton           profile.Skeleton    `json:"skeleton"`
+	Wellness           []db.WellnessUnsafe `json:"wellness" jsonschema_description:"Daily wellness entries (sleep, soreness, mood, resting heart rate) of the last two weeks, most recent first"`
+	TSSThisWeek        float64             `json:"tss_this_week,omitempty" jsonschema_description:"Total Training Stress Score of power-metered activities this week"`
+	TSSLastWeek        float64             `json:"tss_last_week,omitempty" jsonschema_description:"Total Training Stress Score of power-metered activities last week"`
+	LoadThisWeek       map[string]int      `json:"load_this_week" jsonschema_description:"Per sport, the distance in meters this week adjusted for climbing, surface, urban riding, wind and temperature into flat-road equivalent effort"`
+	LoadLastWeek       map[string]int      `json:"load_last_week" jsonschema_description:"Per sport, the adjusted flat-road equivalent distance in meters last week"`
+	Pacing             []Pacing            `json:"pacing" jsonschema_description:"Pacing of the activities of this week and last week that have laps, most recent first"`
 }
 
-func Read(dbh *sql.DB) *Fitness {
-	profileData := profile.Read()
+func totalTSS(activities []db.ActivityUnsafe) float64 {
+	total := 0.0
+	for _, activity := range activities {
+		total += activity.TSS
+	}
+	return total
+}
+
+func Read(dbh *sql.DB, athleteID int64, paths config.Paths) (*Fitness, error) {
+	profileData, err := profile.Read(paths.Prefs())
+	if err != nil {
+		return nil, err
+	}
+
 	startOfWeek := util.BeginningOfWeek(time.Now())
 	startOfLastWeek := startOfWeek.AddDate(0, 0, -7)
 
-	activities, err := db.LastActivities(dbh, 60)
+	activities, err := db.LastActivities(dbh, athleteID, 60)
 	if err != nil {
-		util.Fatalf("error getting activities: %v\n", err)
+		return nil, fmt.Errorf("error getting activities: %v", err)
 	}
 
 	var thisWeek, lastWeek, older []db.ActivityUnsafe
@@ -41,7 +62,17 @@ func Read(dbh *sql.DB) *Fitness {
 		}
 	}
 
-	skeleton, err := profile.ReadSkeleton()
+	wellness, err := db.WellnessSince(dbh, athleteID, startOfLastWeek)
+	if err != nil {
+		return nil, fmt.Errorf("error getting wellness: %v", err)
+	}
+
+	laps, err := db.LapsSince(dbh, athleteID, startOfLastWeek)
+	if err != nil {
+		return nil, fmt.Errorf("error getting laps: %v", err)
+	}
+
+	skeleton, err := profile.ReadSkeleton(paths.Skeleton())
 	if err != nil {
 		// If skeleton doesn't exist or can't be read, use empty skeleton
 		skeleton = &profile.Skeleton{}
@@ -53,9 +84,15 @@ func Read(dbh *sql.DB) *Fitness {
 		ActivitiesLastWeek: lastWeek,
 		ActivitiesOlder:    older,
 		Skeleton:           *skeleton,
+		Wellness:           wellness,
+		TSSThisWeek:        totalTSS(thisWeek),
+		TSSLastWeek:        totalTSS(lastWeek),
+		LoadThisWeek:       effectiveDistanceBySport(thisWeek),
+		LoadLastWeek:       effectiveDistanceBySport(lastWeek),
+		Pacing:             pacingOfActivities(slices.Concat(thisWeek, lastWeek), laps),
 	}
 
-	return &fitness
+	return &fitness, nil
 }
 
 // JSONSchema returns the JSON schema for the Fitness struct
@@ -0,0 +1,74 @@
+package fitness
+
+import (
+	"math"
+
+	"github.com/vasilisp/velora/internal/db"
+)
+
+// surfaceFactors scale distance by how much harder a surface is than road.
+var surfaceFactors = map[string]float64{
+	"road":   1.0,
+	"track":  1.0,
+	"gravel": 1.15,
+	"trail":  1.25,
+}
+
+const (
+	windThreshold = 15 // km/h, as documented on db.LoadFactors
+	heatThreshold = 25
+	heatFactor    = 0.02
+	coldThreshold = 0
+	coldFactor    = 0.01
+)
+
+// EffectiveDistance estimates the flat-road distance in meters that would take
+// the same effort as the activity, accounting for climbing, surface, urban
+// stop-and-go activities, wind and temperature. The factors for climbing,
+// towns and wind come from the sport.
+func EffectiveDistance(a db.ActivityUnsafe) int {
+	load := db.LoadFactors{}
+	if sport, err := db.SportFromString(a.Sport); err == nil {
+		load = sport.Info().Load
+	}
+
+	distance := float64(a.Distance) + load.Climb*float64(a.VerticalGain)
+
+	if a.Indoor {
+		return int(math.Round(distance))
+	}
+
+	factor := 1.0
+	if surfaceFactor, found := surfaceFactors[a.Surface]; found {
+		factor *= surfaceFactor
+	}
+
+	if a.Urban {
+		factor *= 1 + load.Urban
+	}
+
+	if a.WindSpeed > windThreshold {
+		factor *= 1 + load.Wind*float64(a.WindSpeed-windThreshold)
+	}
+
+	if a.Temperature != nil {
+		switch t := *a.Temperature; {
+		case t > heatThreshold:
+			factor *= 1 + heatFactor*float64(t-heatThreshold)
+		case t < coldThreshold:
+			factor *= 1 + coldFactor*float64(coldThreshold-t)
+		}
+	}
+
+	return int(math.Round(distance * factor))
+}
+
+// effectiveDistanceBySport sums the effective distance of the activities per
+// sport.
+func effectiveDistanceBySport(activities []db.ActivityUnsafe) map[string]int {
+	totals := map[string]int{}
+	for _, activity := range activities {
+		totals[activity.Sport] += EffectiveDistance(activity)
+	}
+	return totals
+}
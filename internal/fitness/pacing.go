@@ -0,0 +1,104 @@
+package fitness
+
+import (
+	"math"
+
+	"github.com/vasilisp/velora/internal/db"
+)
+
+// evenSplitTolerance is the relative pace difference between the two halves
+// of an activity below which the split counts as even.
+const evenSplitTolerance = 0.02
+
+// Pacing summarizes how evenly an activity with laps was paced.
+type Pacing struct {
+	ActivityID     int64   `json:"activity_id"`
+	Date           string  `json:"date" jsonschema_description:"The date of the activity in YYYY-MM-DD format"`
+	Sport          string  `json:"sport"`
+	Laps           int     `json:"laps" jsonschema_description:"The number of laps"`
+	FirstHalfPace  int     `json:"first_half_pace" jsonschema_description:"The pace over the first half of the laps in seconds per kilometer"`
+	SecondHalfPace int     `json:"second_half_pace" jsonschema_description:"The pace over the second half of the laps in seconds per kilometer"`
+	Split          string  `json:"split" jsonschema:"enum=negative,enum=even,enum=positive" jsonschema_description:"Negative if the second half was faster, positive if it was slower, even if within 2%"`
+	PaceVariation  float64 `json:"pace_variation" jsonschema_description:"The coefficient of variation of the lap paces in percent; lower means steadier pacing"`
+}
+
+func paceOf(laps []db.Lap) int {
+	total := db.Lap{}
+	for _, lap := range laps {
+		total.Distance += lap.Distance
+		total.Duration += lap.Duration
+	}
+	return total.Pace()
+}
+
+func paceVariation(laps []db.Lap) float64 {
+	paces := []float64{}
+	for _, lap := range laps {
+		if pace := lap.Pace(); pace > 0 {
+			paces = append(paces, float64(pace))
+		}
+	}
+
+	if len(paces) < 2 {
+		return 0
+	}
+
+	mean := 0.0
+	for _, pace := range paces {
+		mean += pace
+	}
+	mean /= float64(len(paces))
+
+	variance := 0.0
+	for _, pace := range paces {
+		variance += (pace - mean) * (pace - mean)
+	}
+	variance /= float64(len(paces))
+
+	return math.Round(math.Sqrt(variance)/mean*1000) / 10
+}
+
+// pacingOf summarizes the laps of an activity, or returns false if there are
+// too few laps with a distance to judge the pacing.
+func pacingOf(activity db.ActivityUnsafe, laps []db.Lap) (Pacing, bool) {
+	if len(laps) < 2 {
+		return Pacing{}, false
+	}
+
+	half := len(laps) / 2
+	firstHalf, secondHalf := paceOf(laps[:half]), paceOf(laps[half:])
+	if firstHalf == 0 || secondHalf == 0 {
+		return Pacing{}, false
+	}
+
+	split := "even"
+	switch difference := float64(secondHalf-firstHalf) / float64(firstHalf); {
+	case difference < -evenSplitTolerance:
+		split = "negative"
+	case difference > evenSplitTolerance:
+		split = "positive"
+	}
+
+	return Pacing{
+		ActivityID:     activity.ID,
+		Date:           activity.Time.Format("2006-01-02"),
+		Sport:          activity.Sport,
+		Laps:           len(laps),
+		FirstHalfPace:  firstHalf,
+		SecondHalfPace: secondHalf,
+		Split:          split,
+		PaceVariation:  paceVariation(laps),
+	}, true
+}
+
+// pacingOfActivities summarizes the pacing of the given activities that have
+// laps, in the order of the activities.
+func pacingOfActivities(activities []db.ActivityUnsafe, laps map[int64][]db.Lap) []Pacing {
+	pacing := []Pacing{}
+	for _, activity := range activities {
+		if summary, ok := pacingOf(activity, laps[activity.ID]); ok {
+			pacing = append(pacing, summary)
+		}
+	}
+	return pacing
+}
@@ -0,0 +1,384 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vasilisp/velora/internal/db"
+)
+
+// Mapping describes how the columns of a CSV file map onto activities.
+type Mapping struct {
+	// Columns maps activity fields, by their JSON name, to column headers.
+	// A header that appears more than once refers to its first column;
+	// "Header#2" refers to the second one, and so on. The special field
+	// "file" names the column holding the path of the device file of the
+	// activity, which archives refer to.
+	Columns map[string]string `json:"columns"`
+	// DateFormat is a Go time layout; RFC 3339 if empty
+	DateFormat string `json:"date_format,omitempty"`
+	// Timezone is the IANA name of the timezone of dates without one; local
+	// time if empty
+	Timezone string `json:"timezone,omitempty"`
+	// DistanceUnit is m, km (the default) or mi
+	DistanceUnit string `json:"distance_unit,omitempty"`
+	// ElevationUnit is m (the default) or ft
+	ElevationUnit string `json:"elevation_unit,omitempty"`
+	// Sports maps the values of the sport column to registered sports;
+	// values not listed are matched like activity types in device files
+	Sports map[string]string `json:"sports,omitempty"`
+}
+
+// StravaMapping reads the activities.csv of a Strava account export. Strava
+// repeats some headers: the first Distance column is in the display units of
+// the account, and the kilometers it shows for rides are meters for swims,
+// while the second one is always in meters.
+var StravaMapping = Mapping{
+	Columns: map[string]string{
+		"time":             "Activity Date",
+		"sport":            "Activity Type",
+		"notes":            "Activity Name",
+		"distance":         "Distance#2",
+		"duration":         "Moving Time",
+		"duration_total":   "Elapsed Time",
+		"vertical_gain":    "Elevation Gain",
+		"avg_heart_rate":   "Average Heart Rate",
+		"max_heart_rate":   "Max Heart Rate",
+		"avg_power":        "Average Watts",
+		"normalized_power": "Weighted Average Power",
+		"file":             "Filename",
+	},
+	DateFormat:   "Jan 2, 2006, 3:04:05 PM",
+	Timezone:     "UTC",
+	DistanceUnit: "m",
+	Sports: map[string]string{
+		"Virtual Ride":       "cycling",
+		"Gravel Ride":        "cycling",
+		"Mountain Bike Ride": "cycling",
+		"E-Bike Ride":        "cycling",
+		"Trail Run":          "running",
+		"Virtual Run":        "running",
+	},
+}
+
+// ReadMapping reads a mapping from a JSON file, or returns the preset of
+// that name.
+func ReadMapping(path string) (Mapping, error) {
+	if path == "strava" {
+		return StravaMapping, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Mapping{}, fmt.Errorf("error reading mapping: %v", err)
+	}
+
+	var m Mapping
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Mapping{}, fmt.Errorf("error parsing mapping: %v", err)
+	}
+
+	return m, nil
+}
+
+var distanceUnits = map[string]float64{"m": 1, "km": 1000, "mi": 1609.344}
+
+var elevationUnits = map[string]float64{"m": 1, "ft": 0.3048}
+
+// csvFields are the activity fields a mapping can fill, by JSON name.
+var csvFields = map[string]func(m Mapping, a *db.ActivityUnsafe, value string) error{
+	"time": func(m Mapping, a *db.ActivityUnsafe, value string) (err error) {
+		a.Time, err = m.parseTime(value)
+		return err
+	},
+	"sport": func(m Mapping, a *db.ActivityUnsafe, value string) (err error) {
+		a.Sport, err = m.parseSport(value)
+		return err
+	},
+	"notes": func(m Mapping, a *db.ActivityUnsafe, value string) error {
+		a.Notes = value
+		return nil
+	},
+	"distance": func(m Mapping, a *db.ActivityUnsafe, value string) (err error) {
+		a.Distance, err = parseScaled(value, distanceUnits[m.distanceUnit()])
+		return err
+	},
+	"vertical_gain": func(m Mapping, a *db.ActivityUnsafe, value string) (err error) {
+		a.VerticalGain, err = parseScaled(value, elevationUnits[m.elevationUnit()])
+		return err
+	},
+	"duration": func(m Mapping, a *db.ActivityUnsafe, value string) (err error) {
+		a.Duration, err = parseDuration(value)
+		return err
+	},
+	"duration_total": func(m Mapping, a *db.ActivityUnsafe, value string) (err error) {
+		a.DurationTotal, err = parseDuration(value)
+		return err
+	},
+	"avg_heart_rate": func(m Mapping, a *db.ActivityUnsafe, value string) (err error) {
+		a.AvgHeartRate, err = parseScaled(value, 1)
+		return err
+	},
+	"max_heart_rate": func(m Mapping, a *db.ActivityUnsafe, value string) (err error) {
+		a.MaxHeartRate, err = parseScaled(value, 1)
+		return err
+	},
+	"avg_power": func(m Mapping, a *db.ActivityUnsafe, value string) (err error) {
+		a.AvgPower, err = parseScaled(value, 1)
+		return err
+	},
+	"normalized_power": func(m Mapping, a *db.ActivityUnsafe, value string) (err error) {
+		a.NormPower, err = parseScaled(value, 1)
+		return err
+	},
+	"rpe": func(m Mapping, a *db.ActivityUnsafe, value string) (err error) {
+		a.RPE, err = parseScaled(value, 1)
+		return err
+	},
+}
+
+func (m Mapping) distanceUnit() string {
+	if m.DistanceUnit == "" {
+		return "km"
+	}
+	return m.DistanceUnit
+}
+
+func (m Mapping) elevationUnit() string {
+	if m.ElevationUnit == "" {
+		return "m"
+	}
+	return m.ElevationUnit
+}
+
+func (m Mapping) validate() error {
+	for _, field := range []string{"time", "sport"} {
+		if _, found := m.Columns[field]; !found {
+			return fmt.Errorf("mapping has no column for %s", field)
+		}
+	}
+
+	for field := range m.Columns {
+		if _, found := csvFields[field]; !found && field != "file" {
+			return fmt.Errorf("mapping refers to unknown field %s", field)
+		}
+	}
+
+	if _, found := distanceUnits[m.distanceUnit()]; !found {
+		return fmt.Errorf("invalid distance unit: %s (expected m, km, or mi)", m.DistanceUnit)
+	}
+
+	if _, found := elevationUnits[m.elevationUnit()]; !found {
+		return fmt.Errorf("invalid elevation unit: %s (expected m or ft)", m.ElevationUnit)
+	}
+
+	if _, err := time.LoadLocation(m.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %v", err)
+	}
+
+	return nil
+}
+
+func (m Mapping) parseTime(value string) (time.Time, error) {
+	layout := m.DateFormat
+	if layout == "" {
+		layout = time.RFC3339
+	}
+
+	location := time.Local
+	if m.Timezone != "" {
+		location, _ = time.LoadLocation(m.Timezone)
+	}
+
+	t, err := time.ParseInLocation(layout, value, location)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %q", value)
+	}
+
+	return t, nil
+}
+
+func (m Mapping) parseSport(value string) (string, error) {
+	if sport, found := m.Sports[value]; found {
+		value = sport
+	}
+
+	if sport := sportFromType(value); sport != "" {
+		return sport, nil
+	}
+
+	return "", fmt.Errorf("unknown sport %q; map it in the mapping, or define it in sports.json", value)
+}
+
+// parseNumber parses a number written with thousands separators or a decimal
+// comma. A single comma followed by three digits, as in 1,500, separates
+// thousands; other commas, as in 12,5, are decimal commas unless the number
+// also has a decimal point.
+func parseNumber(value string) (float64, error) {
+	number := value
+	switch commas := strings.Count(value, ","); {
+	case commas == 0:
+	case strings.Contains(value, "."):
+		number = strings.ReplaceAll(value, ",", "")
+	case commas == 1 && len(value)-strings.Index(value, ",") != 4:
+		number = strings.Replace(value, ",", ".", 1)
+	default:
+		number = strings.ReplaceAll(value, ",", "")
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+
+	return n, nil
+}
+
+// parseScaled parses a number and converts it to the unit velora uses, given
+// how many of those units one unit of the value is.
+func parseScaled(value string, scale float64) (int, error) {
+	n, err := parseNumber(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+
+	return int(math.Round(n * scale)), nil
+}
+
+// parseDuration parses hh:mm:ss, mm:ss, or a number of seconds; the seconds
+// may have a fraction.
+func parseDuration(value string) (int, error) {
+	if !strings.Contains(value, ":") {
+		return parseScaled(value, 1)
+	}
+
+	parts := strings.Split(value, ":")
+	seconds, err := parseNumber(parts[len(parts)-1])
+	if err != nil || seconds >= 60 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	minutes := 0
+	for _, part := range parts[:len(parts)-1] {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		minutes = minutes*60 + n
+	}
+
+	return minutes*60 + int(math.Round(seconds)), nil
+}
+
+// columnIndex finds the column of a header, which may pick one of several
+// columns with the same header by a #n suffix.
+func columnIndex(header []string, column string) (int, error) {
+	name, occurrence := column, 1
+	if i := strings.LastIndex(column, "#"); i >= 0 {
+		if n, err := strconv.Atoi(column[i+1:]); err == nil && n >= 1 {
+			name, occurrence = column[:i], n
+		}
+	}
+
+	for i, h := range header {
+		if h != name {
+			continue
+		}
+		if occurrence--; occurrence == 0 {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("CSV file has no column %q", column)
+}
+
+// CSVRow is an activity read from a row of a CSV file, or the reason it could
+// not be read.
+type CSVRow struct {
+	Line     int
+	Activity db.ActivityUnsafe
+	// File is the value of the file column, if the mapping has one
+	File string
+	Err  error
+}
+
+// ReadCSV reads an activity from every row of a CSV file with a header. Rows
+// that cannot be read are returned with their error, so that they can be
+// reported.
+func ReadCSV(r io.Reader, m Mapping) ([]CSVRow, error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %v", err)
+	}
+
+	indices := map[string]int{}
+	for field, column := range m.Columns {
+		index, err := columnIndex(header, column)
+		if err != nil {
+			return nil, err
+		}
+		indices[field] = index
+	}
+
+	rows := []CSVRow{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV: %v", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := CSVRow{Line: line}
+
+		for _, field := range slices.Sorted(maps.Keys(indices)) {
+			index := indices[field]
+			value := ""
+			if index < len(record) {
+				value = strings.TrimSpace(record[index])
+			}
+			if value == "" {
+				continue
+			}
+
+			if field == "file" {
+				row.File = value
+				continue
+			}
+
+			if err := csvFields[field](m, &row.Activity, value); err != nil {
+				row.Err = fmt.Errorf("%s: %v", field, err)
+				break
+			}
+		}
+
+		if row.Err == nil && row.Activity.Time.IsZero() {
+			row.Err = fmt.Errorf("no date")
+		}
+		if row.Err == nil && row.Activity.Sport == "" {
+			row.Err = fmt.Errorf("no sport")
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,157 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScaled(t *testing.T) {
+	tests := []struct {
+		value string
+		unit  string
+		want  int
+	}{
+		{"1500", "m", 1500},
+		{"1500.0", "m", 1500},
+		{"10.02", "km", 10020},
+		{"12,5", "km", 12500},
+		{"1,500", "m", 1500},
+		{"1,234,567", "m", 1234567},
+		{"1,500.5", "m", 1501},
+		{"6.2", "mi", 9978},
+		{"0,5", "mi", 805},
+	}
+
+	for _, test := range tests {
+		got, err := parseScaled(test.value, distanceUnits[test.unit])
+		if err != nil || got != test.want {
+			t.Errorf("parseScaled(%q, %s) = %d, %v, want %d", test.value, test.unit, got, err, test.want)
+		}
+	}
+
+	for _, value := range []string{"", "abc", "-1", "1,2,3.4.5"} {
+		if _, err := parseScaled(value, 1); err == nil {
+			t.Errorf("parseScaled(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"3100", 3100},
+		{"3100.0", 3100},
+		{"52:10", 3130},
+		{"0:52:10", 3130},
+		{"1:02:03", 3723},
+		{"1:02:03.5", 3724},
+		{"1:02:03,4", 3723},
+	}
+
+	for _, test := range tests {
+		got, err := parseDuration(test.value)
+		if err != nil || got != test.want {
+			t.Errorf("parseDuration(%q) = %d, %v, want %d", test.value, got, err, test.want)
+		}
+	}
+
+	for _, value := range []string{"1:xx", "1:-2:03", "1:75", "1::3"} {
+		if _, err := parseDuration(value); err == nil {
+			t.Errorf("parseDuration(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestStravaDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"Mar 3, 2025, 6:12:40 AM", time.Date(2025, 3, 3, 6, 12, 40, 0, time.UTC)},
+		{"Nov 18, 2024, 5:00:00 PM", time.Date(2024, 11, 18, 17, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		got, err := StravaMapping.parseTime(test.value)
+		if err != nil || !got.Equal(test.want) {
+			t.Errorf("parseTime(%q) = %v, %v, want %v", test.value, got, err, test.want)
+		}
+	}
+
+	if _, err := StravaMapping.parseTime("2025-03-03"); err == nil {
+		t.Errorf("parseTime accepted a date in another format")
+	}
+}
+
+func TestColumnIndex(t *testing.T) {
+	header := []string{"Activity Date", "Distance", "Elapsed Time", "Distance"}
+
+	tests := []struct {
+		column string
+		want   int
+	}{
+		{"Distance", 1},
+		{"Distance#1", 1},
+		{"Distance#2", 3},
+		{"Elapsed Time", 2},
+		{"Distance#3", -1},
+		{"Moving Time", -1},
+	}
+
+	for _, test := range tests {
+		got, err := columnIndex(header, test.column)
+		if got != test.want || (err == nil) != (test.want >= 0) {
+			t.Errorf("columnIndex(%q) = %d, %v, want %d", test.column, got, err, test.want)
+		}
+	}
+}
+
+// stravaCSV has the repeated headers of a Strava export: the first Distance
+// column is in the display units of the account, the second in meters.
+const stravaCSV = `Activity ID,Activity Date,Activity Name,Activity Type,Elapsed Time,Distance,Max Heart Rate,Filename,Elapsed Time,Moving Time,Distance,Elevation Gain,Average Heart Rate,Average Watts,Weighted Average Power
+1,"Mar 3, 2025, 6:12:40 AM",Morning Run,Run,3100,6.23,171.0,,3100.0,3000.0,10020.0,55.0,150.0,,
+2,"Mar 7, 2025, 7:00:00 AM",Swim,Swim,1900,"1,500",,,1900,1800,1500.0,,,,
+3,"Mar 8, 2025, 7:00:00 AM",Ride,Ride,3600,24.9,165.0,activities/3.fit.gz,3600,3500,40100.5,120,140.0,210.0,230.0
+4,"Mar 9, 2025, 7:00:00 AM",Lift,Weight Training,2700,0,,,2700,2700,0,,,,
+`
+
+func TestReadStravaCSV(t *testing.T) {
+	rows, err := ReadCSV(strings.NewReader(stravaCSV), StravaMapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows, want 4", len(rows))
+	}
+
+	tests := []struct {
+		sport    string
+		distance int
+		duration int
+		file     string
+	}{
+		{"running", 10020, 3000, ""},
+		{"swimming", 1500, 1800, ""},
+		{"cycling", 40101, 3500, "activities/3.fit.gz"},
+	}
+
+	for i, test := range tests {
+		row := rows[i]
+		if row.Err != nil {
+			t.Errorf("line %d: %v", row.Line, row.Err)
+			continue
+		}
+		if row.Activity.Sport != test.sport || row.Activity.Distance != test.distance || row.Activity.Duration != test.duration || row.File != test.file {
+			t.Errorf("line %d: got %s %dm %ds %q, want %s %dm %ds %q", row.Line,
+				row.Activity.Sport, row.Activity.Distance, row.Activity.Duration, row.File,
+				test.sport, test.distance, test.duration, test.file)
+		}
+	}
+
+	if rows[3].Err == nil {
+		t.Errorf("line %d: unknown sport accepted", rows[3].Line)
+	}
+}
@@ -0,0 +1,184 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/vasilisp/velora/internal/db"
+	"github.com/vasilisp/velora/internal/fit"
+	"github.com/vasilisp/velora/internal/track"
+)
+
+// field numbers of the FIT messages read, from the FIT SDK profile
+const (
+	recordLat         = 0
+	recordLon         = 1
+	recordAltitude    = 2
+	recordHeartRate   = 3
+	recordCadence     = 4
+	recordPower       = 7
+	recordTemperature = 13
+	recordEnhancedAlt = 78
+
+	lapElapsedTime  = 7
+	lapTimerTime    = 8
+	lapDistance     = 9
+	lapAvgHeartRate = 15
+	lapAvgPower     = 19
+	lapTotalAscent  = 21
+
+	sessionSport        = 5
+	sessionSubSport     = 6
+	sessionElapsedTime  = 7
+	sessionTimerTime    = 8
+	sessionDistance     = 9
+	sessionCalories     = 11
+	sessionAvgHeartRate = 16
+	sessionMaxHeartRate = 17
+	sessionAvgCadence   = 18
+	sessionAvgPower     = 20
+	sessionTotalAscent  = 22
+	sessionNormPower    = 34
+)
+
+// fitSports maps the FIT sport enum to activity types.
+var fitSports = map[int64]string{
+	1:  "running",
+	2:  "cycling",
+	5:  "swimming",
+	11: "walking",
+	15: "rowing",
+	17: "hiking",
+}
+
+// fitIndoorSubSports are the FIT sub sports that take place indoors:
+// treadmill, spin, indoor cycling, indoor rowing, lap swimming and virtual
+// activities.
+var fitIndoorSubSports = map[int64]bool{1: true, 5: true, 6: true, 14: true, 17: true, 58: true}
+
+// semicircles converts a FIT position to degrees.
+func semicircles(value int64) float64 {
+	return float64(value) * 180 / math.Pow(2, 31)
+}
+
+// scaled converts a FIT value stored with a scale, rounding it.
+func scaled(m fit.Message, field uint8, scale float64) int {
+	value, _ := m.Get(field)
+	return int(math.Round(float64(value) / scale))
+}
+
+func fitPoint(m fit.Message) (track.Point, bool) {
+	timestamp, found := m.Get(fit.FieldTimestamp)
+	if !found {
+		return track.Point{}, false
+	}
+
+	point := track.Point{Time: fit.Time(timestamp)}
+
+	lat, hasLat := m.Get(recordLat)
+	lon, hasLon := m.Get(recordLon)
+	if hasLat && hasLon {
+		point.Lat, point.Lon = semicircles(lat), semicircles(lon)
+	}
+
+	altitude, found := m.Get(recordEnhancedAlt)
+	if !found {
+		altitude, found = m.Get(recordAltitude)
+	}
+	if found {
+		elevation := float64(altitude)/5 - 500
+		point.Elevation = &elevation
+	}
+
+	if heartRate, found := m.Get(recordHeartRate); found {
+		point.HeartRate = int(heartRate)
+	}
+	if power, found := m.Get(recordPower); found {
+		point.Power = int(power)
+	}
+
+	return point, true
+}
+
+func fitLap(m fit.Message) db.Lap {
+	lap := db.Lap{
+		Distance:     scaled(m, lapDistance, 100),
+		Duration:     scaled(m, lapTimerTime, 1000),
+		AvgHeartRate: scaled(m, lapAvgHeartRate, 1),
+		AvgPower:     scaled(m, lapAvgPower, 1),
+		VerticalGain: scaled(m, lapTotalAscent, 1),
+	}
+
+	if lap.Duration == 0 {
+		lap.Duration = scaled(m, lapElapsedTime, 1000)
+	}
+
+	return lap
+}
+
+// ParseFIT reads the records, laps and session of a FIT activity file. The
+// session totals become the device summary of the file.
+func ParseFIT(r io.Reader) (File, error) {
+	messages, err := fit.Decode(r)
+	if err != nil {
+		return File{}, err
+	}
+
+	file := File{}
+	var skipped unmapped
+	sessions := 0
+
+	for _, m := range messages {
+		switch m.Num {
+		case fit.MesgRecord:
+			if point, ok := fitPoint(m); ok {
+				file.Track.Points = append(file.Track.Points, point)
+			}
+			_, hasCadence := m.Get(recordCadence)
+			skipped.add(hasCadence, "cadence")
+			_, hasTemperature := m.Get(recordTemperature)
+			skipped.add(hasTemperature, "temperature")
+		case fit.MesgLap:
+			if lap := fitLap(m); lap.Duration > 0 {
+				file.Laps = append(file.Laps, lap)
+			}
+		case fit.MesgSession:
+			sessions++
+
+			if sport, found := m.Get(sessionSport); found {
+				file.Sport = sportFromType(fitSports[sport])
+			}
+			if subSport, found := m.Get(sessionSubSport); found {
+				file.Indoor = fitIndoorSubSports[subSport]
+			}
+
+			file.Summary = track.Metrics{
+				Distance:     scaled(m, sessionDistance, 100),
+				VerticalGain: scaled(m, sessionTotalAscent, 1),
+				MovingTime:   scaled(m, sessionTimerTime, 1000),
+				ElapsedTime:  scaled(m, sessionElapsedTime, 1000),
+				AvgHeartRate: scaled(m, sessionAvgHeartRate, 1),
+				MaxHeartRate: scaled(m, sessionMaxHeartRate, 1),
+				AvgPower:     scaled(m, sessionAvgPower, 1),
+			}
+			file.NormPower = scaled(m, sessionNormPower, 1)
+
+			_, hasCadence := m.Get(sessionAvgCadence)
+			skipped.add(hasCadence, "cadence")
+			_, hasCalories := m.Get(sessionCalories)
+			skipped.add(hasCalories, "calories")
+		}
+	}
+
+	if sessions > 1 {
+		return File{}, fmt.Errorf("multisport FIT files with %d sessions are not supported", sessions)
+	}
+
+	if len(file.Track.Points) == 0 {
+		return File{}, fmt.Errorf("FIT file has no records")
+	}
+
+	file.Unmapped = skipped
+	return file, nil
+}
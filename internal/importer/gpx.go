@@ -0,0 +1,77 @@
+package importer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/vasilisp/velora/internal/track"
+)
+
+type gpxPoint struct {
+	Lat       float64   `xml:"lat,attr"`
+	Lon       float64   `xml:"lon,attr"`
+	Elevation *float64  `xml:"ele"`
+	Time      time.Time `xml:"time"`
+	// Garmin's TrackPointExtension, and the power extension written by
+	// Strava and Wahoo
+	HeartRate int `xml:"extensions>TrackPointExtension>hr"`
+	Cadence   int `xml:"extensions>TrackPointExtension>cad"`
+	Power     int `xml:"extensions>power"`
+}
+
+type gpx struct {
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// ParseGPX reads the tracks of a GPX file. Multiple tracks and segments are
+// joined into one track.
+func ParseGPX(r io.Reader) (File, error) {
+	var g gpx
+	if err := xml.NewDecoder(r).Decode(&g); err != nil {
+		return File{}, fmt.Errorf("error parsing GPX: %v", err)
+	}
+
+	file := File{}
+	var skipped unmapped
+	for _, trk := range g.Tracks {
+		if file.Name == "" {
+			file.Name = trk.Name
+		}
+		if file.Sport == "" {
+			file.Sport = sportFromType(trk.Type)
+		}
+
+		for _, segment := range trk.Segments {
+			for _, point := range segment.Points {
+				if point.Time.IsZero() {
+					return File{}, fmt.Errorf("GPX track point without time")
+				}
+
+				file.Track.Points = append(file.Track.Points, track.Point{
+					Time:      point.Time,
+					Lat:       point.Lat,
+					Lon:       point.Lon,
+					Elevation: point.Elevation,
+					HeartRate: point.HeartRate,
+					Power:     point.Power,
+				})
+				skipped.add(point.Cadence > 0, "cadence")
+			}
+		}
+	}
+
+	if len(file.Track.Points) == 0 {
+		return File{}, fmt.Errorf("GPX file has no track points")
+	}
+
+	file.Unmapped = skipped
+	return file, nil
+}
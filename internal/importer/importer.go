@@ -0,0 +1,221 @@
+// Package importer reads activities from the files exported by devices and
+// training platforms.
+package importer
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vasilisp/velora/internal/db"
+	"github.com/vasilisp/velora/internal/track"
+	"github.com/vasilisp/velora/internal/util"
+)
+
+// File is an activity read from a file, before it becomes an activity.
+// Sport is empty when the file does not tell.
+type File struct {
+	Sport string
+	Name  string
+	Track track.Track
+	Laps  []db.Lap
+	// Summary holds the totals recorded by the device, which take
+	// precedence over the ones derived from the track
+	Summary track.Metrics
+	// NormPower and Indoor are taken from the device summary, if it has them
+	NormPower int
+	Indoor    bool
+	// Unmapped lists the data in the file that velora has no place for
+	Unmapped []string
+}
+
+// maxSpeed is a speed in m/s that no human-powered activity averages over its
+// moving time.
+const maxSpeed = 100 / 3.6
+
+// CheckSpeed rejects an activity whose distance and moving time imply an
+// impossible speed, which usually means that the distance was read in the
+// wrong unit.
+func CheckSpeed(a db.ActivityUnsafe) error {
+	if a.Distance == 0 || a.Duration == 0 {
+		return nil
+	}
+
+	speed := float64(a.Distance) / float64(a.Duration)
+	if speed > maxSpeed {
+		return fmt.Errorf("%s in %s is %.0f km/h; check the distance and its unit",
+			util.FormatDistance(a.Distance), util.FormatDuration(a.Duration), speed*3.6)
+	}
+
+	return nil
+}
+
+// unmapped collects the kinds of data in a file that velora has no place
+// for, each listed once.
+type unmapped []string
+
+func (u *unmapped) add(present bool, what string) {
+	if !present {
+		return
+	}
+	for _, existing := range *u {
+		if existing == what {
+			return
+		}
+	}
+	*u = append(*u, what)
+}
+
+// sportTypes maps the activity types used by devices and platforms to
+// sports. Strava writes numeric types in its GPX exports.
+var sportTypes = map[string]string{
+	"1":                   "cycling",
+	"ride":                "cycling",
+	"biking":              "cycling",
+	"road_biking":         "cycling",
+	"mountain_biking":     "cycling",
+	"gravel_cycling":      "cycling",
+	"indoor_cycling":      "cycling",
+	"virtualride":         "cycling",
+	"9":                   "running",
+	"run":                 "running",
+	"trail_running":       "running",
+	"treadmill_running":   "running",
+	"virtualrun":          "running",
+	"swim":                "swimming",
+	"lap_swimming":        "swimming",
+	"open_water_swimming": "swimming",
+}
+
+// sportFromType returns the registered sport named by an activity type, or
+// the empty string if there is none.
+func sportFromType(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if sport, found := sportTypes[t]; found {
+		return sport
+	}
+
+	if sport, err := db.SportFromString(t); err == nil {
+		return sport.String()
+	}
+
+	return ""
+}
+
+// Read parses a file by the extension of its name, decompressing gzipped
+// files first.
+func Read(name string, r io.Reader) (File, error) {
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".gz":
+		decompressed, err := gzip.NewReader(r)
+		if err != nil {
+			return File{}, fmt.Errorf("error decompressing: %v", err)
+		}
+		defer decompressed.Close()
+
+		return Read(strings.TrimSuffix(name, filepath.Ext(name)), decompressed)
+	case ".gpx":
+		return ParseGPX(r)
+	case ".tcx":
+		return ParseTCX(r)
+	case ".fit":
+		return ParseFIT(r)
+	default:
+		return File{}, fmt.Errorf("unsupported file type: %s", ext)
+	}
+}
+
+// ReadFile opens and parses the file at path.
+func ReadFile(path string) (File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+
+	file, err := Read(path, f)
+	if err != nil {
+		return File{}, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	return file, nil
+}
+
+// withSummary overrides the derived metrics with the ones the device
+// recorded.
+func withSummary(derived track.Metrics, summary track.Metrics) track.Metrics {
+	override := func(value *int, recorded int) {
+		if recorded > 0 {
+			*value = recorded
+		}
+	}
+
+	override(&derived.Distance, summary.Distance)
+	override(&derived.VerticalGain, summary.VerticalGain)
+	override(&derived.MovingTime, summary.MovingTime)
+	override(&derived.ElapsedTime, summary.ElapsedTime)
+	override(&derived.AvgHeartRate, summary.AvgHeartRate)
+	override(&derived.MaxHeartRate, summary.MaxHeartRate)
+	override(&derived.AvgPower, summary.AvgPower)
+
+	derived.ElapsedTime = max(derived.ElapsedTime, derived.MovingTime)
+	return derived
+}
+
+// lapsOf keeps the lap metrics that are tracked for the sport.
+func lapsOf(laps []db.Lap, info db.SportInfo) []db.Lap {
+	result := make([]db.Lap, len(laps))
+	for i, lap := range laps {
+		if !info.Has(db.MetricHeartRate) {
+			lap.AvgHeartRate = 0
+		}
+		if !info.Has(db.MetricPower) {
+			lap.AvgPower = 0
+		}
+		if !info.Has(db.MetricVerticalGain) {
+			lap.VerticalGain = 0
+		}
+		result[i] = lap
+	}
+	return result
+}
+
+// Activity turns the file into an activity of its sport, with the metrics
+// derived from its track and the track itself attached.
+func (f File) Activity() (db.ActivityUnsafe, error) {
+	if len(f.Track.Points) == 0 {
+		return db.ActivityUnsafe{}, fmt.Errorf("no track points")
+	}
+
+	sport, err := db.SportFromString(f.Sport)
+	if err != nil {
+		return db.ActivityUnsafe{}, err
+	}
+
+	activity := db.ActivityUnsafe{
+		Time:   f.Track.Points[0].Time,
+		Sport:  f.Sport,
+		Notes:  f.Name,
+		Indoor: f.Indoor,
+	}
+	withSummary(f.Track.Metrics(), f.Summary).Apply(&activity)
+
+	if f.NormPower > 0 && sport.Info().Has(db.MetricPower) {
+		activity.NormPower = f.NormPower
+	}
+
+	if len(f.Laps) > 0 {
+		activity.Laps = lapsOf(f.Laps, sport.Info())
+	}
+
+	data, err := f.Track.Encode()
+	if err != nil {
+		return activity, err
+	}
+	activity.Track = data
+
+	return activity, nil
+}
@@ -0,0 +1,92 @@
+package importer
+
+import (
+	"archive/zip"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/vasilisp/velora/internal/db"
+)
+
+// Archive is the zip of a Strava account export: an activities.csv, and the
+// device files of the activities it lists.
+type Archive struct {
+	zip *zip.ReadCloser
+	// dir is the directory of activities.csv, which file paths are
+	// relative to
+	dir  string
+	Rows []CSVRow
+}
+
+// OpenArchive opens a Strava export and reads its activities.csv through the
+// mapping.
+func OpenArchive(name string, m Mapping) (*Archive, error) {
+	z, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %v", name, err)
+	}
+
+	a := &Archive{zip: z}
+	for _, f := range z.File {
+		if path.Base(f.Name) != "activities.csv" {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			z.Close()
+			return nil, fmt.Errorf("error opening %s: %v", f.Name, err)
+		}
+		defer r.Close()
+
+		a.dir = path.Dir(f.Name)
+		if a.Rows, err = ReadCSV(r, m); err != nil {
+			z.Close()
+			return nil, fmt.Errorf("error reading %s: %v", f.Name, err)
+		}
+
+		return a, nil
+	}
+
+	z.Close()
+	return nil, fmt.Errorf("%s has no activities.csv", name)
+}
+
+func (a *Archive) Close() error {
+	return a.zip.Close()
+}
+
+// Activity returns the activity of a row. When the row refers to a device
+// file, the activity is read from the file, keeping the sport and name from
+// the row; otherwise it is the row itself. It also returns the data of the
+// file that could not be imported.
+func (a *Archive) Activity(row CSVRow) (db.ActivityUnsafe, []string, error) {
+	if row.Err != nil {
+		return row.Activity, nil, row.Err
+	}
+
+	if row.File == "" {
+		return row.Activity, nil, nil
+	}
+
+	name := path.Join(a.dir, row.File)
+	r, err := a.zip.Open(name)
+	if err != nil {
+		return row.Activity, nil, err
+	}
+	defer r.Close()
+
+	file, err := Read(name, r)
+	if err != nil {
+		return row.Activity, nil, fmt.Errorf("error reading %s: %v", name, err)
+	}
+
+	file.Sport = row.Activity.Sport
+	if strings.TrimSpace(row.Activity.Notes) != "" {
+		file.Name = row.Activity.Notes
+	}
+
+	activity, err := file.Activity()
+	return activity, file.Unmapped, err
+}
@@ -0,0 +1,160 @@
+package importer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/vasilisp/velora/internal/db"
+	"github.com/vasilisp/velora/internal/track"
+)
+
+type tcxTrackpoint struct {
+	Time      time.Time `xml:"Time"`
+	Lat       float64   `xml:"Position>LatitudeDegrees"`
+	Lon       float64   `xml:"Position>LongitudeDegrees"`
+	Altitude  *float64  `xml:"AltitudeMeters"`
+	HeartRate int       `xml:"HeartRateBpm>Value"`
+	Cadence   int       `xml:"Cadence"`
+	// Garmin's ActivityExtension
+	Power int `xml:"Extensions>TPX>Watts"`
+}
+
+type tcxLap struct {
+	TotalTimeSeconds float64         `xml:"TotalTimeSeconds"`
+	DistanceMeters   float64         `xml:"DistanceMeters"`
+	MaximumSpeed     float64         `xml:"MaximumSpeed"`
+	Calories         int             `xml:"Calories"`
+	AvgHeartRate     int             `xml:"AverageHeartRateBpm>Value"`
+	MaxHeartRate     int             `xml:"MaximumHeartRateBpm>Value"`
+	Cadence          int             `xml:"Cadence"`
+	AvgPower         float64         `xml:"Extensions>LX>AvgWatts"`
+	MaxPower         int             `xml:"Extensions>LX>MaxWatts"`
+	Points           []tcxTrackpoint `xml:"Track>Trackpoint"`
+}
+
+type tcx struct {
+	Activities []struct {
+		Sport string   `xml:"Sport,attr"`
+		Notes string   `xml:"Notes"`
+		Laps  []tcxLap `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+// lapOf summarizes a TCX lap, taking what the lap does not record from its
+// track points.
+func lapOf(lap tcxLap, points []track.Point) db.Lap {
+	metrics := track.Track{Points: points}.Metrics()
+
+	result := db.Lap{
+		Distance:     int(math.Round(lap.DistanceMeters)),
+		Duration:     int(math.Round(lap.TotalTimeSeconds)),
+		AvgHeartRate: lap.AvgHeartRate,
+		AvgPower:     int(math.Round(lap.AvgPower)),
+		VerticalGain: metrics.VerticalGain,
+	}
+
+	if result.AvgHeartRate == 0 {
+		result.AvgHeartRate = metrics.AvgHeartRate
+	}
+	if result.AvgPower == 0 {
+		result.AvgPower = metrics.AvgPower
+	}
+
+	return result
+}
+
+// ParseTCX reads the first activity of a TCX file, with its laps. The totals
+// of the laps become the device summary of the file.
+func ParseTCX(r io.Reader) (File, error) {
+	var t tcx
+	if err := xml.NewDecoder(r).Decode(&t); err != nil {
+		return File{}, fmt.Errorf("error parsing TCX: %v", err)
+	}
+
+	if len(t.Activities) == 0 {
+		return File{}, fmt.Errorf("TCX file has no activities")
+	}
+	activity := t.Activities[0]
+
+	file := File{
+		Sport: sportFromType(activity.Sport),
+		Name:  activity.Notes,
+	}
+
+	var skipped unmapped
+	if len(t.Activities) > 1 {
+		skipped = append(skipped, fmt.Sprintf("%d more activities", len(t.Activities)-1))
+	}
+
+	heartRateTime, powerTime := 0.0, 0.0
+	lapsIncomplete := false
+	for i, lap := range activity.Laps {
+		points := []track.Point{}
+		for _, point := range lap.Points {
+			if point.Time.IsZero() {
+				return File{}, fmt.Errorf("TCX track point without time")
+			}
+
+			points = append(points, track.Point{
+				Time:      point.Time,
+				Lat:       point.Lat,
+				Lon:       point.Lon,
+				Elevation: point.Altitude,
+				HeartRate: point.HeartRate,
+				Power:     point.Power,
+			})
+			skipped.add(point.Cadence > 0, "cadence")
+		}
+		file.Track.Points = append(file.Track.Points, points...)
+
+		// laps without a duration cannot be stored, but their distance
+		// still counts towards the activity, and the moving time then comes
+		// from the track
+		l := lapOf(lap, points)
+		if l.Duration <= 0 {
+			skipped = append(skipped, fmt.Sprintf("lap %d without duration", i+1))
+			file.Summary.Distance += l.Distance
+			lapsIncomplete = true
+			continue
+		}
+		file.Laps = append(file.Laps, l)
+
+		// the activity averages are the lap averages weighted by time
+		file.Summary.Distance += l.Distance
+		file.Summary.MovingTime += l.Duration
+		file.Summary.MaxHeartRate = max(file.Summary.MaxHeartRate, lap.MaxHeartRate)
+		if l.AvgHeartRate > 0 {
+			file.Summary.AvgHeartRate += l.AvgHeartRate * l.Duration
+			heartRateTime += float64(l.Duration)
+		}
+		if l.AvgPower > 0 {
+			file.Summary.AvgPower += l.AvgPower * l.Duration
+			powerTime += float64(l.Duration)
+		}
+
+		skipped.add(lap.Cadence > 0, "cadence")
+		skipped.add(lap.Calories > 0, "calories")
+		skipped.add(lap.MaximumSpeed > 0, "maximum speed")
+		skipped.add(lap.MaxPower > 0, "maximum power")
+	}
+
+	if lapsIncomplete {
+		file.Summary.MovingTime = 0
+	}
+	if heartRateTime > 0 {
+		file.Summary.AvgHeartRate = int(math.Round(float64(file.Summary.AvgHeartRate) / heartRateTime))
+	}
+	if powerTime > 0 {
+		file.Summary.AvgPower = int(math.Round(float64(file.Summary.AvgPower) / powerTime))
+	}
+
+	if len(file.Track.Points) == 0 {
+		return File{}, fmt.Errorf("TCX file has no track points")
+	}
+
+	file.Unmapped = skipped
+	return file, nil
+}
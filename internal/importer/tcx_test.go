@@ -0,0 +1,52 @@
+package importer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// lapsTCX has a 1000m lap, and a 500m lap without a duration, as some devices
+// write for a lap that was started and stopped within a second.
+const lapsTCX = `<?xml version="1.0"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">
+<Activities><Activity Sport="Running">
+<Lap><TotalTimeSeconds>300</TotalTimeSeconds><DistanceMeters>1000</DistanceMeters>
+<AverageHeartRateBpm><Value>150</Value></AverageHeartRateBpm>
+<Track>
+<Trackpoint><Time>2025-03-03T06:00:00Z</Time><Position><LatitudeDegrees>38.0</LatitudeDegrees><LongitudeDegrees>23.7</LongitudeDegrees></Position></Trackpoint>
+<Trackpoint><Time>2025-03-03T06:05:00Z</Time><Position><LatitudeDegrees>38.009</LatitudeDegrees><LongitudeDegrees>23.7</LongitudeDegrees></Position></Trackpoint>
+</Track></Lap>
+<Lap><TotalTimeSeconds>0</TotalTimeSeconds><DistanceMeters>500</DistanceMeters>
+<Track>
+<Trackpoint><Time>2025-03-03T06:05:00Z</Time><Position><LatitudeDegrees>38.009</LatitudeDegrees><LongitudeDegrees>23.7</LongitudeDegrees></Position></Trackpoint>
+</Track></Lap>
+</Activity></Activities>
+</TrainingCenterDatabase>`
+
+func TestParseTCXLapWithoutDuration(t *testing.T) {
+	file, err := ParseTCX(strings.NewReader(lapsTCX))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if file.Sport != "running" {
+		t.Errorf("sport = %q, want running", file.Sport)
+	}
+
+	if len(file.Laps) != 1 || file.Laps[0].Distance != 1000 || file.Laps[0].Duration != 300 {
+		t.Errorf("laps = %+v, want one 1000m lap of 300s", file.Laps)
+	}
+
+	if file.Summary.Distance != 1500 {
+		t.Errorf("summary distance = %d, want 1500", file.Summary.Distance)
+	}
+
+	if file.Summary.MovingTime != 0 {
+		t.Errorf("summary moving time = %d, want 0 so that the track's is used", file.Summary.MovingTime)
+	}
+
+	if !slices.Contains(file.Unmapped, "lap 2 without duration") {
+		t.Errorf("unmapped = %q, want the lap without duration reported", file.Unmapped)
+	}
+}
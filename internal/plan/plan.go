@@ -13,7 +13,6 @@ import (
 	"github.com/vasilisp/lingograph/store"
 	"github.com/vasilisp/velora/internal/db"
 	"github.com/vasilisp/velora/internal/fitness"
-	"github.com/vasilisp/velora/internal/profile"
 	"github.com/vasilisp/velora/internal/template"
 	"github.com/vasilisp/velora/internal/util"
 )
@@ -26,8 +25,9 @@ type Planner struct {
 
 type PlanDay struct {
 	Date     string       `json:"date" jsonschema_description:"The date of the planned workout in YYYY-MM-DD format"`
-	Sport    string       `json:"sport" jsonschema_description:"The type of sport (running, cycling, swimming)"`
+	Sport    db.Sport     `json:"sport" jsonschema_description:"The type of sport"`
 	Distance int          `json:"distance" jsonschema_description:"The planned distance in meters"`
+	Duration int          `json:"duration,omitempty" jsonschema_description:"The planned duration in seconds; required for sports measured by duration"`
 	Notes    string       `json:"notes" jsonschema_description:"Additional notes and instructions for the workout, in one line"`
 	Segments []db.Segment `json:"segments" jsonschema_description:"The segments of the workout"`
 }
@@ -40,12 +40,12 @@ type Plan struct {
 func (p Plan) Write(out io.Writer) {
 	fmt.Fprintf(out, "Plan:\n\n")
 	for _, day := range p.Days {
-		fmt.Fprintf(out, "  - Date: %s\n    Sport: %s\n    Distance: %d\n    Notes: %s\n",
-			day.Date, day.Sport, day.Distance, day.Notes)
-		for _, segment := range day.Segments {
-			fmt.Fprintf(out, "      - Repeat: %d\n        Distance: %d\n        Zone: %d\n",
-				segment.Repeat, segment.Distance, segment.Zone)
+		fmt.Fprintf(out, "  - Date: %s\n    Sport: %s\n    Distance: %d\n", day.Date, day.Sport, day.Distance)
+		if day.Duration > 0 {
+			fmt.Fprintf(out, "    Duration: %s\n", time.Duration(day.Duration)*time.Second)
 		}
+		fmt.Fprintf(out, "    Notes: %s\n", day.Notes)
+		db.OutputSegmentsTo(out, "    ", day.Segments)
 	}
 	fmt.Fprintf(out, "\nExplanation: %s\n", p.Explanation)
 }
@@ -79,9 +79,8 @@ type allowedDisallowedDayStrings struct {
 	Disallowed []string
 }
 
-func nextNDays(fitnessData *fitness.Fitness, sport profile.Sport, numDays int) allowedDisallowedDays {
+func nextNDays(fitnessData *fitness.Fitness, sport db.Sport, numDays int) allowedDisallowedDays {
 	skeleton := fitnessData.Skeleton
-	sportStr := sport.String()
 	today := time.Now()
 	startDate := today
 
@@ -104,7 +103,7 @@ func nextNDays(fitnessData *fitness.Fitness, sport profile.Sport, numDays int) a
 		weekday := date.Weekday().String()
 		allowed := true
 		for _, conflict := range skeleton.Conflicts {
-			if conflict.Weekday == weekday && conflict.Sport == sportStr {
+			if conflict.Weekday == weekday && conflict.Sport == sport {
 				allowed = false
 				break
 			}
@@ -128,14 +127,27 @@ func FormatDates(dates []time.Time) []string {
 	return formattedDates
 }
 
-func (p Planner) userPromptOfSport(sport profile.Sport, numDays int) (string, allowedDisallowedDays) {
+// zoneDescriptions lists the intensity zones of a sport, numbered from 1.
+func zoneDescriptions(sport db.Sport) []string {
+	zones := sport.Info().Zones
+	descriptions := make([]string, len(zones))
+	for i, zone := range zones {
+		descriptions[i] = fmt.Sprintf("Zone %d: %s", i+1, zone)
+	}
+	return descriptions
+}
+
+func (p Planner) userPromptOfSport(sport db.Sport, numDays int) (string, allowedDisallowedDays) {
 	days := nextNDays(p.fitness, sport, numDays)
 
 	m := map[string]any{
-		"allowed":    FormatDates(days.Allowed),
-		"disallowed": FormatDates(days.Disallowed),
-		"sport":      sport.String(),
-		"numDays":    numDays,
+		"allowed":     FormatDates(days.Allowed),
+		"disallowed":  FormatDates(days.Disallowed),
+		"sport":       sport.String(),
+		"measure":     sport.Info().Measure.String(),
+		"zones":       zoneDescriptions(sport),
+		"numDays":     numDays,
+		"preferences": p.fitness.Profile.Sports[sport],
 	}
 
 	if len(days.Allowed) == 0 {
@@ -229,7 +241,7 @@ Your task is to summarize the given workout plan and output it to the user.
 Only respond with a function call.
 `
 
-func (p Planner) singleSport(sport profile.Sport, userPrompt string) {
+func (p Planner) singleSport(sport db.Sport, userPrompt string) {
 	actor := openai.NewActor(p.client, openai.GPT5, p.systemPrompt(), nil)
 	actorOutputPlan := actorOutputPlan(p.client, openai.GPT5Nano, systemPromptSummarize)
 
@@ -267,7 +279,7 @@ func InteractivePipeline(actor lingograph.Actor) lingograph.Pipeline {
 }
 
 func (p Planner) MultiStep(interactive bool, numDays int) {
-	sportMap := make(map[profile.Sport]*sportData)
+	sportMap := make(map[db.Sport]*sportData)
 
 	for _, sport := range p.fitness.Profile.AllSports() {
 		userPrompt, days := p.userPromptOfSport(sport, numDays)
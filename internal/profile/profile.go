@@ -2,42 +2,22 @@ package profile
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
-	"path/filepath"
+	"slices"
 	"time"
 
-	"github.com/vasilisp/velora/internal/util"
+	"github.com/vasilisp/velora/internal/db"
 )
 
-type Sport uint8
-
-const (
-	Cycling Sport = iota
-	Running
-)
-
-func (s Sport) String() string {
-	util.Assert(s >= Cycling && s <= Running, "invalid sport")
-	return []string{"cycling", "running"}[s]
-}
-
-func ParseSport(s string) Sport {
-	switch s {
-	case "cycling":
-		return Cycling
-	case "running":
-		return Running
-	}
-
-	util.Fatalf("invalid sport: %s", s)
-	panic("unreachable")
-}
-
 type SportPreferences struct {
 	TargetWeeklyDistance uint      `json:"target_weekly_distance"`
 	TargetDistance       uint      `json:"target_distance"`
 	TrainsIndoors        bool      `json:"trains_indoors"`
 	TargetDistanceDate   time.Time `json:"target_distance_date,omitempty"`
+	// PoolLength is the length in meters of the pool the athlete swims in;
+	// only meaningful for swimming
+	PoolLength uint `json:"pool_length,omitempty"`
 }
 
 func (sc SportPreferences) MarshalJSON() ([]byte, error) {
@@ -87,60 +67,40 @@ func (sc *SportPreferences) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-type SportMap map[Sport]SportPreferences
-
-func (sm SportMap) MarshalJSON() ([]byte, error) {
-	sportsMap := make(map[string]SportPreferences)
-	for sport, constraints := range sm {
-		sportsMap[sport.String()] = constraints
-	}
-
-	return json.Marshal(sportsMap)
-}
-
-func (sm *SportMap) UnmarshalJSON(data []byte) error {
-	util.Assert(sm != nil, "sm is nil")
-	stringMap := make(map[string]SportPreferences)
-
-	if err := json.Unmarshal(data, &stringMap); err != nil {
-		return err
-	}
-
-	*sm = make(SportMap)
-	for sportStr, constraints := range stringMap {
-		sport := ParseSport(sportStr)
-		(*sm)[sport] = constraints
-	}
-
-	return nil
-}
+// SportMap holds the preferences per sport. Sports are encoded by name, so
+// unknown sports are rejected when reading.
+type SportMap map[db.Sport]SportPreferences
 
 type Profile struct {
 	Sports SportMap `json:"sports"`
 	FTP    uint     `json:"ftp"`
 }
 
-func Read() Profile {
-	profilePath := filepath.Join(os.Getenv("HOME"), ".velora", "prefs.json")
-	profileBytes := []byte{}
-
-	profileBytes, err := os.ReadFile(profilePath)
+func Read(path string) (Profile, error) {
+	profileBytes, err := os.ReadFile(path)
 	if err != nil {
-		util.Fatalf("error reading profile: %v\n", err)
+		return Profile{}, fmt.Errorf("error reading profile: %v", err)
 	}
 
 	var p Profile
 	if err := json.Unmarshal(profileBytes, &p); err != nil {
-		util.Fatalf("error unmarshalling profile: %v\n", err)
+		return Profile{}, fmt.Errorf("error unmarshalling profile %s: %v", path, err)
+	}
+
+	for sport, preferences := range p.Sports {
+		if preferences.PoolLength != 0 && sport != db.Swimming {
+			return Profile{}, fmt.Errorf("error in profile %s: pool_length is only valid for swimming", path)
+		}
 	}
 
-	return p
+	return p, nil
 }
 
-func (p Profile) AllSports() []Sport {
-	sports := make([]Sport, 0, len(p.Sports))
+func (p Profile) AllSports() []db.Sport {
+	sports := make([]db.Sport, 0, len(p.Sports))
 	for sport := range p.Sports {
 		sports = append(sports, sport)
 	}
+	slices.Sort(sports)
 	return sports
 }
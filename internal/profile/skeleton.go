@@ -3,48 +3,43 @@ package profile
 import (
 	"encoding/json"
 	"os"
-	"path/filepath"
 
 	"github.com/vasilisp/velora/internal/db"
 )
 
 type SkeletonDay struct {
 	Weekday     string       `json:"weekday" jsonschema_description:"The day of the week (Monday, Tuesday, etc.)"`
-	Sport       string       `json:"sport" jsonschema_description:"The type of sport (running, cycling, swimming)"`
+	Sport       db.Sport     `json:"sport" jsonschema_description:"The type of sport"`
 	DistanceMin int          `json:"distance_min" jsonschema_description:"Minimum suggested distance in meters"`
 	Segments    []db.Segment `json:"segments" jsonschema_description:"The segments of the workout"`
 }
 
 type SkeletonConflict struct {
-	Weekday string `json:"weekday" jsonschema_description:"The day of the week (Monday, Tuesday, etc.)"`
-	Sport   string `json:"sport" jsonschema_description:"The type of sport (running, cycling, swimming) not allowed on the specific  day"`
+	Weekday string   `json:"weekday" jsonschema_description:"The day of the week (Monday, Tuesday, etc.)"`
+	Sport   db.Sport `json:"sport" jsonschema_description:"The type of sport not allowed on the specific day"`
 }
 
 type Skeleton struct {
-	Sports    []string           `json:"sports" jsonschema_description:"The sports that are allowed in the plan (running, cycling, swimming)"`
+	Sports    []db.Sport         `json:"sports" jsonschema_description:"The sports that are allowed in the plan"`
 	Days      []SkeletonDay      `json:"days" jsonschema_description:"The days of the week and their suggested workouts"`
 	Conflicts []SkeletonConflict `json:"conflicts" jsonschema_description:"The days of the week and the sports that are not allowed on that day"`
 }
 
-func skeletonPath() string {
-	return filepath.Join(os.Getenv("HOME"), ".velora", "skeleton.json")
-}
-
-func WriteSkeleton(skeleton *Skeleton) error {
+func WriteSkeleton(path string, skeleton *Skeleton) error {
 	json, err := json.MarshalIndent(skeleton, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(skeletonPath(), json, 0644)
+	return os.WriteFile(path, json, 0644)
 }
 
-func ReadSkeleton() (*Skeleton, error) {
-	jsonBytes, err := os.ReadFile(skeletonPath())
+func ReadSkeleton(path string) (*Skeleton, error) {
+	jsonBytes, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return &Skeleton{
-				Sports:    []string{},
+				Sports:    []db.Sport{},
 				Days:      []SkeletonDay{},
 				Conflicts: []SkeletonConflict{},
 			}, nil
@@ -0,0 +1,182 @@
+package track
+
+import (
+	"math"
+
+	"github.com/vasilisp/velora/internal/db"
+)
+
+const (
+	earthRadius = 6371000.0 // meters
+
+	// elevationWindow is the number of samples averaged to smooth out
+	// barometer and GPS noise before counting elevation gain
+	elevationWindow = 5
+	// elevationThreshold is the climb in meters needed before it counts
+	// towards the elevation gain, so that small oscillations are ignored
+	elevationThreshold = 2.0
+
+	// minMovingSpeed is the speed in m/s below which the athlete is
+	// considered stopped
+	minMovingSpeed = 0.5
+)
+
+// Metrics are the summary values derived from a track.
+type Metrics struct {
+	Distance     int // meters
+	VerticalGain int // meters
+	MovingTime   int // seconds
+	ElapsedTime  int // seconds
+	AvgHeartRate int
+	MaxHeartRate int
+	AvgPower     int
+}
+
+func toRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// distance returns the great-circle distance between two points in meters.
+func distance(a, b Point) float64 {
+	lat1, lat2 := toRadians(a.Lat), toRadians(b.Lat)
+	dLat, dLon := lat2-lat1, toRadians(b.Lon-a.Lon)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// smoothElevations returns the centered moving average of the elevations of
+// the points that have one.
+func smoothElevations(points []Point) []float64 {
+	elevations := []float64{}
+	for _, point := range points {
+		if point.Elevation != nil {
+			elevations = append(elevations, *point.Elevation)
+		}
+	}
+
+	smoothed := make([]float64, len(elevations))
+	for i := range elevations {
+		from, to := max(0, i-elevationWindow/2), min(len(elevations), i+elevationWindow/2+1)
+		sum := 0.0
+		for _, elevation := range elevations[from:to] {
+			sum += elevation
+		}
+		smoothed[i] = sum / float64(to-from)
+	}
+
+	return smoothed
+}
+
+func verticalGain(points []Point) float64 {
+	elevations := smoothElevations(points)
+	if len(elevations) == 0 {
+		return 0
+	}
+
+	gain, reference := 0.0, elevations[0]
+	for _, elevation := range elevations[1:] {
+		switch {
+		case elevation-reference >= elevationThreshold:
+			gain += elevation - reference
+			reference = elevation
+		case elevation < reference:
+			reference = elevation
+		}
+	}
+
+	return gain
+}
+
+// Metrics derives the distance, elevation gain, moving and elapsed time, and
+// heart rate and power averages of the track.
+func (t Track) Metrics() Metrics {
+	points := t.Points
+	if len(points) == 0 {
+		return Metrics{}
+	}
+
+	total, moving := 0.0, 0.0
+	hasPosition := false
+	for i := 1; i < len(points); i++ {
+		previous, current := points[i-1], points[i]
+		seconds := current.Time.Sub(previous.Time).Seconds()
+		if seconds <= 0 {
+			continue
+		}
+
+		if !previous.hasPosition() || !current.hasPosition() {
+			continue
+		}
+		hasPosition = true
+
+		meters := distance(previous, current)
+		total += meters
+		if meters/seconds >= minMovingSpeed {
+			moving += seconds
+		}
+	}
+
+	elapsed := points[len(points)-1].Time.Sub(points[0].Time).Seconds()
+	if !hasPosition || moving == 0 {
+		// without movement we cannot tell pauses apart
+		moving = elapsed
+	}
+
+	metrics := Metrics{
+		Distance:     int(math.Round(total)),
+		VerticalGain: int(math.Round(verticalGain(points))),
+		MovingTime:   int(math.Round(moving)),
+		ElapsedTime:  int(math.Round(elapsed)),
+	}
+
+	heartRateSum, heartRateSamples, powerSum := 0, 0, 0
+	for _, point := range points {
+		if point.HeartRate > 0 {
+			heartRateSum += point.HeartRate
+			heartRateSamples++
+			metrics.MaxHeartRate = max(metrics.MaxHeartRate, point.HeartRate)
+		}
+		powerSum += point.Power
+	}
+
+	if heartRateSamples > 0 {
+		metrics.AvgHeartRate = heartRateSum / heartRateSamples
+	}
+	// points record no power when coasting, so once a track has power data
+	// every point counts towards the average
+	if powerSum > 0 {
+		metrics.AvgPower = powerSum / len(points)
+	}
+
+	return metrics
+}
+
+// Apply overwrites the fields of the activity that the track determines,
+// leaving the ones it has no data for, or that are not tracked for the sport
+// of the activity, untouched. Duration is the moving time and DurationTotal
+// the elapsed time.
+func (m Metrics) Apply(activity *db.ActivityUnsafe) {
+	info := db.SportInfo{}
+	if sport, err := db.SportFromString(activity.Sport); err == nil {
+		info = sport.Info()
+	}
+
+	if m.ElapsedTime > 0 {
+		activity.Duration = m.MovingTime
+		activity.DurationTotal = m.ElapsedTime
+	}
+	if m.Distance > 0 {
+		activity.Distance = m.Distance
+	}
+	if m.VerticalGain > 0 && info.Has(db.MetricVerticalGain) {
+		activity.VerticalGain = m.VerticalGain
+	}
+	if m.AvgHeartRate > 0 && info.Has(db.MetricHeartRate) {
+		activity.AvgHeartRate = m.AvgHeartRate
+		activity.MaxHeartRate = m.MaxHeartRate
+	}
+	if m.AvgPower > 0 && info.Has(db.MetricPower) {
+		activity.AvgPower = m.AvgPower
+	}
+}
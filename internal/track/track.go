@@ -0,0 +1,80 @@
+package track
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Point is a single sample of a recorded activity. Samples without a GPS fix
+// (e.g., indoors) have zero coordinates, and those without elevation data a
+// nil Elevation.
+type Point struct {
+	Time      time.Time `json:"t"`
+	Lat       float64   `json:"lat,omitempty"`
+	Lon       float64   `json:"lon,omitempty"`
+	Elevation *float64  `json:"ele,omitempty"`
+	HeartRate int       `json:"hr,omitempty"`
+	Power     int       `json:"pw,omitempty"`
+}
+
+func (p Point) hasPosition() bool {
+	return p.Lat != 0 || p.Lon != 0
+}
+
+// Track is the stream of samples recorded by a device, in time order.
+type Track struct {
+	Points []Point `json:"points"`
+}
+
+// encodingVersion is bumped whenever the encoded format changes, so that
+// tracks stored by older versions can still be decoded.
+const encodingVersion = 1
+
+type encoded struct {
+	Version int `json:"version"`
+	Track
+}
+
+// Encode serializes the track as gzip-compressed JSON, for storage.
+func (t Track) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	writer := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(writer).Encode(encoded{Version: encodingVersion, Track: t}); err != nil {
+		return nil, fmt.Errorf("error encoding track: %v", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("error compressing track: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func Decode(data []byte) (Track, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return Track{}, fmt.Errorf("error decompressing track: %v", err)
+	}
+	defer reader.Close()
+
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		return Track{}, fmt.Errorf("error decompressing track: %v", err)
+	}
+
+	var e encoded
+	if err := json.Unmarshal(decompressed, &e); err != nil {
+		return Track{}, fmt.Errorf("error decoding track: %v", err)
+	}
+
+	if e.Version > encodingVersion {
+		return Track{}, fmt.Errorf("track encoding version %d is newer than supported version %d", e.Version, encodingVersion)
+	}
+
+	return e.Track, nil
+}
@@ -70,6 +70,18 @@ func FormatDuration(seconds int) string {
 	return fmt.Sprintf("%dm", minutes)
 }
 
+// FormatShortDuration is like FormatDuration, but keeps the seconds of
+// durations under an hour, as needed for intervals.
+func FormatShortDuration(seconds int) string {
+	if seconds >= 3600 || seconds%60 == 0 {
+		return FormatDuration(seconds)
+	}
+	if seconds < 60 {
+		return fmt.Sprintf("%ds", seconds)
+	}
+	return fmt.Sprintf("%dm%02ds", seconds/60, seconds%60)
+}
+
 // BeginningOfWeek returns the time corresponding to Monday of the current week at 00:00.
 func BeginningOfWeek(t time.Time) time.Time {
 	// Normalize to local time zone if needed